@@ -0,0 +1,274 @@
+package dbconnect
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// BreakerState is the state of the circuit breaker of a block
+type BreakerState string
+
+const (
+	// BreakerClosed lets every call through
+	BreakerClosed BreakerState = "closed"
+	// BreakerOpen fails every call with ErrCircuitOpen until the cool-down
+	// has passed
+	BreakerOpen BreakerState = "open"
+	// BreakerHalfOpen lets a single trial through; it closes the breaker
+	// when it succeeds and opens it again when it fails
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// BreakerInfo describes the circuit breaker of a single block
+type BreakerInfo struct {
+	Backend string       `json:"backend"`
+	ID      string       `json:"id"`
+	State   BreakerState `json:"state"`
+	// Failures is the number of consecutive failures seen so far
+	Failures int `json:"failures"`
+	// OpenedAt is when the breaker last opened; zero if it never did
+	OpenedAt time.Time `json:"opened_at"`
+}
+
+// Breakers returns the circuit breaker state of every block configured
+// with breaker_failures, in config order
+func (c *Conns) Breakers() []BreakerInfo {
+	c.mu.RLock()
+	all := c.c.blocks()
+	c.mu.RUnlock()
+
+	var infos []BreakerInfo
+	for _, b := range all {
+		br := b.circuit()
+		if br == nil {
+			continue
+		}
+		br.mu.Lock()
+		infos = append(infos, BreakerInfo{
+			Backend:  b.backend(),
+			ID:       b.ident(),
+			State:    br.state,
+			Failures: br.fails,
+			OpenedAt: br.openedAt,
+		})
+		br.mu.Unlock()
+	}
+	return infos
+}
+
+// breaker is the circuit breaker of a single block. Failures are counted
+// from dials and pings; a nil *breaker lets everything through
+type breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     BreakerState
+	fails     int
+	openedAt  time.Time
+	probing   bool
+}
+
+// newBreaker returns nil when failures is zero, i.e. the breaker is disabled.
+// The cool-down defaults to 30s
+func newBreaker(failures, cooldownSeconds int) *breaker {
+	if failures <= 0 {
+		return nil
+	}
+	if cooldownSeconds <= 0 {
+		cooldownSeconds = 30
+	}
+	return &breaker{
+		threshold: failures,
+		cooldown:  time.Duration(cooldownSeconds) * time.Second,
+		state:     BreakerClosed,
+	}
+}
+
+// allow reports whether a call may go through. probe is set for the single
+// trial let through in the half-open state; its outcome must be recorded
+func (br *breaker) allow() (probe bool, err error) {
+	if br == nil {
+		return false, nil
+	}
+	br.mu.Lock()
+	defer br.mu.Unlock()
+
+	switch br.state {
+	case BreakerOpen:
+		if time.Since(br.openedAt) < br.cooldown {
+			return false, ErrCircuitOpen
+		}
+		br.state = BreakerHalfOpen
+	case BreakerHalfOpen:
+		if br.probing {
+			return false, ErrCircuitOpen
+		}
+	default:
+		return false, nil
+	}
+	br.probing = true
+	return true, nil
+}
+
+// record counts the outcome of a call. Outcomes seen while the breaker is
+// open are ignored, so that the cool-down isn't extended by calls that
+// were already under way
+func (br *breaker) record(err error) {
+	if br == nil || errors.Is(err, ErrCircuitOpen) {
+		return
+	}
+	br.mu.Lock()
+	defer br.mu.Unlock()
+
+	switch {
+	case br.state == BreakerOpen:
+	case err == nil:
+		br.state, br.fails, br.probing = BreakerClosed, 0, false
+	default:
+		br.fails++
+		if br.state == BreakerHalfOpen || br.fails >= br.threshold {
+			br.state, br.openedAt, br.probing = BreakerOpen, time.Now(), false
+		}
+	}
+}
+
+// release gives up a probe without an outcome, e.g. when its caller went away
+func (br *breaker) release() {
+	if br == nil {
+		return
+	}
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	br.probing = false
+}
+
+// guard is called by the getters of b before handing out a pool or client.
+// In the half-open state the caller connects and pings b as the trial
+func (br *breaker) guard(ctx context.Context, b block, connect func(context.Context) error) error {
+	probe, err := br.allow()
+	if err != nil {
+		return blockError(b, ErrCircuitOpen, nil)
+	}
+	if !probe {
+		return nil
+	}
+
+	err = connect(ctx)
+	if err == nil {
+		err = b.ping(ctx)
+	}
+	if err != nil && ctx.Err() != nil {
+		br.release()
+		return blockError(b, ErrConnect, err)
+	}
+	br.record(err)
+	if err != nil {
+		return blockError(b, ErrConnect, err)
+	}
+	return nil
+}
+
+// dial wraps dial so that it fails fast while the breaker is open and
+// its outcome is counted
+func (br *breaker) dial(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if br == nil {
+		return dial
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if br.blocked() {
+			return nil, ErrCircuitOpen
+		}
+		conn, err := dial(ctx, network, addr)
+		br.record(err)
+		return conn, err
+	}
+}
+
+// blocked reports whether the breaker is open and still cooling down.
+// Unlike allow it doesn't start a trial
+func (br *breaker) blocked() bool {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	return br.state == BreakerOpen && time.Since(br.openedAt) < br.cooldown
+}
+
+// ping pings b and counts the outcome on its breaker
+func ping(ctx context.Context, b block) error {
+	err := b.ping(ctx)
+	b.circuit().record(err)
+	return err
+}
+
+// breakerConn is the redis.Conn handed out by GetRedisConn when a breaker
+// is configured. Commands fail fast while the breaker is open; network
+// errors are counted. Error replies from the server, read timeouts, e.g.
+// of a PubSubConn polling a quiet channel, and canceled contexts are not
+type breakerConn struct {
+	redis.Conn
+	br *breaker
+}
+
+func (bc *breakerConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	return bc.DoContext(context.Background(), cmd, args...)
+}
+
+func (bc *breakerConn) DoContext(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	if _, err := bc.br.allow(); err != nil {
+		return nil, err
+	}
+	reply, err := redis.DoContext(bc.Conn, ctx, cmd, args...)
+	bc.count(ctx, err)
+	return reply, err
+}
+
+func (bc *breakerConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	if _, err := bc.br.allow(); err != nil {
+		return nil, err
+	}
+	reply, err := redis.DoWithTimeout(bc.Conn, timeout, cmd, args...)
+	bc.count(context.Background(), err)
+	return reply, err
+}
+
+func (bc *breakerConn) Send(cmd string, args ...interface{}) error {
+	if bc.br.blocked() {
+		return ErrCircuitOpen
+	}
+	return bc.Conn.Send(cmd, args...)
+}
+
+func (bc *breakerConn) Receive() (interface{}, error) {
+	return bc.ReceiveContext(context.Background())
+}
+
+func (bc *breakerConn) ReceiveContext(ctx context.Context) (interface{}, error) {
+	reply, err := redis.ReceiveContext(bc.Conn, ctx)
+	bc.count(ctx, err)
+	return reply, err
+}
+
+func (bc *breakerConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	reply, err := redis.ReceiveWithTimeout(bc.Conn, timeout)
+	bc.count(context.Background(), err)
+	return reply, err
+}
+
+func (bc *breakerConn) count(ctx context.Context, err error) {
+	var rerr redis.Error
+	var nerr net.Error
+	switch {
+	case errors.As(err, &rerr):
+		err = nil
+	case errors.As(err, &nerr) && nerr.Timeout(), errors.Is(err, net.ErrClosed), err != nil && ctx.Err() != nil:
+		// says nothing about the server: redigo closes a conn on its side
+		// after a read timeout, so later calls fail with net.ErrClosed
+		bc.br.release()
+		return
+	}
+	bc.br.record(err)
+}
@@ -0,0 +1,148 @@
+package dbconnect
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestBreaker(t *testing.T) {
+	errDown := errors.New("database is down")
+	br := newBreaker(2, 60)
+
+	br.record(errDown)
+	if _, err := br.allow(); err != nil {
+		t.Fatalf("opened after a single failure: %v", err)
+	}
+	br.record(errDown)
+	if _, err := br.allow(); err != ErrCircuitOpen {
+		t.Fatalf("got %v, want ErrCircuitOpen", err)
+	}
+
+	// a failure seen while open doesn't extend the cool-down
+	br.openedAt = time.Now().Add(-time.Minute)
+	br.record(errDown)
+	probe, err := br.allow()
+	if err != nil || !probe {
+		t.Fatalf("got probe %t and %v after the cool-down, want a probe", probe, err)
+	}
+	if _, err := br.allow(); err != ErrCircuitOpen {
+		t.Fatalf("got %v during the probe, want ErrCircuitOpen", err)
+	}
+
+	// a failed probe opens the breaker again right away
+	br.record(errDown)
+	if br.state != BreakerOpen {
+		t.Fatalf("got %s after a failed probe, want open", br.state)
+	}
+
+	br.openedAt = time.Now().Add(-time.Minute)
+	if _, err := br.allow(); err != nil {
+		t.Fatal(err)
+	}
+	br.record(nil)
+	if br.state != BreakerClosed || br.fails != 0 {
+		t.Fatalf("got %s with %d failures after a successful probe, want closed", br.state, br.fails)
+	}
+
+	if newBreaker(0, 0) != nil {
+		t.Fatal("breaker_failures = 0 should disable the breaker")
+	}
+}
+
+func TestBreakerRedis(t *testing.T) {
+	conns, err := Build(
+		WithRedis("cache", downRedis(&RedisConfig{BreakerFailures: 2})),
+		WithRedis("plain", downRedis(&RedisConfig{})),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conns.Close(context.Background())
+
+	conn, err := conns.GetRedisConnContext(context.Background(), "cache")
+	if err == nil {
+		conn.Close()
+		t.Fatal("dial to port 1 succeeded")
+	}
+	// redigo dials in Get and hands out a conn holding the dial error,
+	// which is the second failure
+	conn, err = conns.GetRedisConn("cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := conns.GetRedisPool("cache"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("got %v, want ErrCircuitOpen", err)
+	}
+	if _, err := conn.Do("PING"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("got %v from a conn handed out earlier, want ErrCircuitOpen", err)
+	}
+	if _, err := conns.GetRedisPool("plain"); err != nil {
+		t.Fatalf("breaker of cache affected plain: %v", err)
+	}
+
+	infos := conns.Breakers()
+	if len(infos) != 1 || infos[0].ID != "cache" || infos[0].State != BreakerOpen || infos[0].Failures != 2 {
+		t.Fatalf("got %+v, want cache open after 2 failures", infos)
+	}
+
+	// the trial after the cool-down fails as well
+	rc, _ := conns.redis("cache")
+	rc.breaker.openedAt = time.Now().Add(-time.Minute)
+	if _, err := conns.GetRedisPool("cache"); !errors.Is(err, ErrConnect) {
+		t.Fatalf("got %v from the trial, want ErrConnect", err)
+	}
+	if infos := conns.Breakers(); infos[0].State != BreakerOpen {
+		t.Fatalf("got %s after a failed trial, want open", infos[0].State)
+	}
+}
+
+func TestBreakerRedisTimeouts(t *testing.T) {
+	// every read times out
+	conns, err := Build(WithRedis("cache", &RedisConfig{
+		Host: "127.0.0.1", Port: silent(t).Port, BreakerFailures: 2,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conns.Close(context.Background())
+
+	// a PubSubConn polling a quiet channel
+	conn, err := conns.GetRedisConn("cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	psc := redis.PubSubConn{Conn: conn}
+	defer psc.Close()
+	for i := 0; i < 3; i++ {
+		if err, ok := psc.ReceiveWithTimeout(10 * time.Millisecond).(error); !ok {
+			t.Fatalf("got %v, want a read timeout", err)
+		}
+	}
+
+	conn, err = conns.GetRedisConn("cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		_, err := redis.DoContext(conn, ctx, "GET", "k")
+		cancel()
+		if err == nil {
+			t.Fatal("got a reply from a server that never answers")
+		}
+	}
+
+	if infos := conns.Breakers(); infos[0].State != BreakerClosed || infos[0].Failures != 0 {
+		t.Fatalf("got %+v, timeouts must not count as failures", infos)
+	}
+	if _, err := conns.GetRedisPool("cache"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,58 @@
+package dbconnect
+
+// Build returns a Conns instance for the blocks given through WithPostgres,
+// WithRoach, WithRedis and WithMongo, without a config file:
+//
+//	conns, err := dbconnect.Build(
+//		dbconnect.WithPostgres("main", &dbconnect.PQConfig{Host: "localhost", User: "app", DB: "app"}),
+//		dbconnect.WithRedis("cache", &dbconnect.RedisConfig{Host: "localhost"}),
+//	)
+//
+// Blocks go through the same env expansion, defaults and validation as
+// blocks read from a file; duplicate ids are an error
+func Build(opts ...Option) (*Conns, error) {
+	return NewFromConfig(&Config{}, opts...)
+}
+
+// WithPostgres adds a postgresql block with the given id. pc is used as
+// is and must not be shared with another Conns instance.
+// It can be combined with any constructor; the block is added after the
+// config has been read
+func WithPostgres(id string, pc *PQConfig) Option {
+	return func(s *settings) {
+		pc.ID = id
+		s.extra.PQ = append(s.extra.PQ, pc)
+	}
+}
+
+// WithRoach adds a cockroachdb block with the given id; see WithPostgres
+func WithRoach(id string, rc *RoachConfig) Option {
+	return func(s *settings) {
+		rc.ID = id
+		s.extra.CockroachDB = append(s.extra.CockroachDB, rc)
+	}
+}
+
+// WithRedis adds a redis block with the given id; see WithPostgres
+func WithRedis(id string, rc *RedisConfig) Option {
+	return func(s *settings) {
+		rc.ID = id
+		s.extra.Redis = append(s.extra.Redis, rc)
+	}
+}
+
+// WithMongo adds a mongo block with the given id; see WithPostgres
+func WithMongo(id string, mc *MongoConfig) Option {
+	return func(s *settings) {
+		mc.ID = id
+		s.extra.Mongo = append(s.extra.Mongo, mc)
+	}
+}
+
+// add appends every block of o to c
+func (c *Config) add(o *Config) {
+	c.PQ = append(c.PQ, o.PQ...)
+	c.CockroachDB = append(c.CockroachDB, o.CockroachDB...)
+	c.Redis = append(c.Redis, o.Redis...)
+	c.Mongo = append(c.Mongo, o.Mongo...)
+}
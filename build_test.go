@@ -0,0 +1,76 @@
+package dbconnect
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBuild(t *testing.T) {
+	type tt struct {
+		name string
+		opts []Option
+		err  bool
+	}
+
+	t.Setenv("DBC_TEST_PQ_HOST", "db.internal")
+
+	tsts := []tt{
+		{
+			name: "valid",
+			opts: []Option{
+				WithPostgres("main", &PQConfig{Host: "${DBC_TEST_PQ_HOST}", User: "app", DB: "app"}),
+				WithRoach("roach", &RoachConfig{Host: "localhost", User: "root", DB: "defaultdb"}),
+				WithRedis("cache", &RedisConfig{Host: "localhost"}),
+				WithMongo("docs", &MongoConfig{}),
+			},
+		},
+		{
+			name: "duplicate id",
+			opts: []Option{
+				WithPostgres("main", &PQConfig{Host: "localhost", User: "app", DB: "app"}),
+				WithPostgres("main", &PQConfig{Host: "localhost", User: "app", DB: "app"}),
+			},
+			err: true,
+		},
+		{
+			name: "invalid block",
+			opts: []Option{
+				WithRoach("roach", &RoachConfig{Host: "localhost", User: "root", DB: "defaultdb", SSLMode: "always"}),
+			},
+			err: true,
+		},
+	}
+
+	for _, tst := range tsts {
+		t.Run(tst.name, func(t *testing.T) {
+			conns, err := Build(tst.opts...)
+			if err != nil {
+				var ve *ValidationError
+				if !tst.err || !errors.As(err, &ve) {
+					t.Fatal(err)
+				}
+				return
+			} else if tst.err {
+				t.Fatal("was supposed to error")
+			}
+
+			pc, err := conns.pq("main")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// same expansion and defaults as file loading
+			if pc.Host != "db.internal" || pc.Port != 5432 {
+				t.Fatalf("got host=%s port=%d", pc.Host, pc.Port)
+			}
+			for _, get := range []func() error{
+				func() error { _, err := conns.roach("roach"); return err },
+				func() error { _, err := conns.redis("cache"); return err },
+				func() error { _, err := conns.mongo("docs"); return err },
+			} {
+				if err := get(); err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+}
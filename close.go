@@ -0,0 +1,109 @@
+package dbconnect
+
+import (
+	"context"
+)
+
+// CloseError lists every block that failed to close, or didn't finish
+// closing before the context passed to Close was done
+type CloseError struct {
+	Problems Problems
+}
+
+func (ce *CloseError) Error() string {
+	return ce.Problems.join("close")
+}
+
+// Close closes every pool and client that was opened: postgresql and
+// cockroachdb pools are closed, redis pools are closed and mongo clients
+// are disconnected. Blocks are closed in parallel; Close returns when all
+// of them are done or ctx is done, whichever comes first. Closing a
+// pgxpool.Pool waits for acquired connections to be released.
+// Any later getter call returns ErrClosed. Also stops Watch
+func (c *Conns) Close(ctx context.Context) error {
+	bs, ok := c.shutdown()
+	if !ok {
+		return nil
+	}
+	return closeBlocks(ctx, bs)
+}
+
+// shutdown marks c closed, stops background work and returns every block
+// to be closed; ok is false when c was closed already
+func (c *Conns) shutdown() (bs []block, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, false
+	}
+	c.closed = true
+	close(c.done)
+	for _, b := range c.c.blocks() {
+		bs = append(bs, b)
+	}
+	bs = append(bs, c.retired...)
+	c.retired = nil
+	return bs, true
+}
+
+// CloseID closes the connections of every backend configured with id;
+// see Close. Later getter calls for id return ErrClosed
+func (c *Conns) CloseID(ctx context.Context, id string) error {
+	c.mu.RLock()
+	if c.closed {
+		c.mu.RUnlock()
+		return &Error{ID: id, Kind: ErrClosed}
+	}
+	var bs []block
+	for _, b := range c.c.blocks() {
+		if b.ident() == id {
+			bs = append(bs, b)
+		}
+	}
+	c.mu.RUnlock()
+
+	if len(bs) == 0 {
+		return &Error{ID: id, Kind: ErrUnknownID}
+	}
+	return closeBlocks(ctx, bs)
+}
+
+// closeBlocks closes bs in parallel and collects every failure. Blocks
+// still closing when ctx is done are reported with ctx.Err()
+func closeBlocks(ctx context.Context, bs []block) error {
+	type result struct {
+		b   block
+		err error
+	}
+
+	pending := map[block]bool{}
+	results := make(chan result, len(bs))
+	for _, b := range bs {
+		// blocks that aren't open yet are closed too, so later getter
+		// calls fail; one still connecting is waited for until ctx is done
+		pending[b] = true
+		go func(b block) {
+			results <- result{b: b, err: b.close(ctx)}
+		}(b)
+	}
+
+	var ce CloseError
+	for len(pending) > 0 {
+		select {
+		case r := <-results:
+			delete(pending, r.b)
+			if r.err != nil {
+				ce.Problems = append(ce.Problems, Problem{Backend: r.b.backend(), ID: r.b.ident(), Err: r.err})
+			}
+		case <-ctx.Done():
+			for _, b := range bs {
+				if pending[b] {
+					ce.Problems = append(ce.Problems, Problem{Backend: b.backend(), ID: b.ident(), Err: ctx.Err()})
+				}
+			}
+			return &ce
+		}
+	}
+
+	return ce.Problems.orNil(&ce)
+}
@@ -0,0 +1,87 @@
+package dbconnect
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestClose(t *testing.T) {
+	conns, err := Build(
+		WithPostgres("main", &PQConfig{Host: "localhost", User: "app", DB: "app"}),
+		WithRedis("cache", &RedisConfig{Host: "localhost"}),
+		WithRedis("sessions", &RedisConfig{Host: "localhost"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// redis pools dial lazily, so they can be opened without a server
+	for _, id := range []string{"cache", "sessions"} {
+		if _, err := conns.GetRedisPool(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := context.Background()
+	if err := conns.CloseID(ctx, "cache"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conns.GetRedisPool("cache"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("got %v, want ErrClosed", err)
+	}
+	if _, err := conns.GetRedisPool("sessions"); err != nil {
+		t.Fatal(err)
+	}
+	if err := conns.CloseID(ctx, "unknown"); err == nil {
+		t.Fatal("was supposed to error")
+	}
+
+	if err := conns.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conns.GetRedisPool("sessions"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("got %v, want ErrClosed", err)
+	}
+	if _, err := conns.GetPQ("main"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("got %v, want ErrClosed", err)
+	}
+	// closing twice is a no-op
+	if err := conns.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// connecting returns a Conns whose pq block "main" is stuck connecting to
+// a server that accepts connections but never answers
+func connecting(t *testing.T) *Conns {
+	conns, err := Build(WithPostgres("main", &PQConfig{
+		Host: "127.0.0.1", Port: silent(t).Port, User: "app", DB: "app", ConnectTimeout: 2,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := conns.GetPQContext(ctx, "main"); err == nil {
+		t.Fatal("connected to a server that never answers")
+	}
+	return conns
+}
+
+func TestCloseDeadline(t *testing.T) {
+	conns := connecting(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := conns.Close(ctx)
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("Close took %v with a 100ms deadline", d)
+	}
+	var ce *CloseError
+	if !errors.As(err, &ce) || len(ce.Problems) != 1 || !errors.Is(ce.Problems[0].Err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want the connecting block reported with the deadline", err)
+	}
+}
@@ -1,51 +1,390 @@
 package dbconnect
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path"
+	"strings"
+	"sync"
 
 	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
 )
 
+// Conns holds every configured connection; blocks connect lazily on
+// first use through the getter functions
 type Conns struct {
+	mu       sync.RWMutex // guards c and the indices; see Watch
 	c        *Config
+	s        *settings
 	pqMap    map[string]int
 	mongoMap map[string]int
 	redisMap map[string]int
 	roachMap map[string]int
+	// paths are the files the config was read from and reload re-reads
+	// them; both are only set by New
+	paths  []string
+	reread func() (*Config, error)
+	closed bool
+	// draining is set by Drain; getters fail from then on
+	draining bool
+	// done is closed by Close to stop background work
+	done chan struct{}
+	// hooks are called by Monitor; see OnStateChange
+	hooks []StateChangeFunc
+	// retired are the blocks replaced by reload and waiting out the grace
+	// period; Close closes them right away
+	retired []block
 }
 
-func New(p string) (*Conns, error) {
-	f, err := os.Open(p)
+// New reads the config file at p and returns a Conns instance.
+// The decoder is picked from the file extension. Overlays given through
+// WithOverlays are read from disk and merged on top of p in order
+func New(p string, opts ...Option) (*Conns, error) {
+	s := newSettings(opts)
+	c, err := s.load(os.ReadFile, source{path: p})
 	if err != nil {
 		return nil, err
 	}
-	bs, err := io.ReadAll(f)
+
+	conns, err := newConns(c, s)
+	if err != nil {
+		return nil, err
+	}
+	conns.paths = append([]string{p}, s.overlays...)
+	conns.reread = func() (*Config, error) {
+		c, err := s.load(os.ReadFile, source{path: p})
+		if err != nil {
+			return nil, err
+		}
+		if err := s.prepare(c); err != nil {
+			return nil, err
+		}
+		conns.bind(c)
+		// blocks added through options are not part of the file; they were
+		// prepared and bound on the first load and are kept as they are,
+		// since getters may be using them
+		c.add(&s.extra)
+		if err := c.Validate(); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	return conns, nil
+}
+
+// NewFromReader decodes a config from r and returns a Conns instance.
+// format is one of "json", "toml", "yaml" or "yml"; a leading dot is allowed.
+// Overlays given through WithOverlays are read from disk
+func NewFromReader(r io.Reader, format string, opts ...Option) (*Conns, error) {
+	bs, err := io.ReadAll(r)
 	if err != nil {
 		return nil, err
 	}
 
+	s := newSettings(opts)
+	c, err := s.load(os.ReadFile, source{format: format, bs: bs})
+	if err != nil {
+		return nil, err
+	}
+	return newConns(c, s)
+}
+
+// NewFromFS reads the config file at p from fsys (e.g. an embed.FS)
+// and returns a Conns instance. The decoder is picked from the file extension.
+// Overlays given through WithOverlays are read from fsys as well
+func NewFromFS(fsys fs.FS, p string, opts ...Option) (*Conns, error) {
+	s := newSettings(opts)
+	c, err := s.load(func(name string) ([]byte, error) {
+		return fs.ReadFile(fsys, name)
+	}, source{path: p})
+	if err != nil {
+		return nil, err
+	}
+	return newConns(c, s)
+}
+
+// NewFromConfig returns a Conns instance for an already populated Config.
+// Overlays given through WithOverlays are read from disk and merged into c
+func NewFromConfig(c *Config, opts ...Option) (*Conns, error) {
+	if c == nil {
+		return nil, fmt.Errorf("nil config")
+	}
+
+	s := newSettings(opts)
+	if err := s.overlay(c, os.ReadFile); err != nil {
+		return nil, err
+	}
+	return newConns(c, s)
+}
+
+func newConns(c *Config, s *settings) (*Conns, error) {
+	c.add(&s.extra)
+	if err := s.prepare(c); err != nil {
+		return nil, err
+	}
+
+	conns := Conns{
+		c:    c,
+		s:    s,
+		done: make(chan struct{}),
+	}
+	conns.index()
+	conns.bind(c)
+	if err := conns.warmupEager(); err != nil {
+		_ = conns.Close(context.Background())
+		return nil, err
+	}
+	conns.log().Info("config loaded", "profile", s.profile,
+		"pq", len(c.PQ), "cockroachdb", len(c.CockroachDB), "redis", len(c.Redis), "mongo", len(c.Mongo))
+	return &conns, nil
+}
+
+// prepare expands env variables and applies defaults to every block of c,
+// then validates the result
+func (s *settings) prepare(c *Config) error {
+	if err := c.expandEnv(); err != nil {
+		return err
+	}
+	c.defaults()
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	return s.secrets.check(c)
+}
+
+// source is a single config document; either a path to be read or
+// already read bytes in the given format
+type source struct {
+	path   string
+	format string
+	bs     []byte
+}
+
+func (s *settings) load(read func(string) ([]byte, error), base source) (*Config, error) {
+	s.profileFound = false
 	var c Config
-	switch path.Ext(p) {
+	if err := s.merge(&c, read, base); err != nil {
+		return nil, err
+	}
+	if err := s.overlay(&c, read); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// overlay merges every overlay file, in order, into c
+func (s *settings) overlay(c *Config, read func(string) ([]byte, error)) error {
+	srcs := []source{}
+	for _, p := range s.overlays {
+		srcs = append(srcs, source{path: p})
+	}
+	if err := s.merge(c, read, srcs...); err != nil {
+		return err
+	}
+
+	if s.profile != "" && !s.profileFound {
+		return fmt.Errorf("profile \"%s\" not found in any config source", s.profile)
+	}
+	return nil
+}
+
+// merge decodes every source and applies it to c, followed by the selected
+// profile of that source if there is one
+func (s *settings) merge(c *Config, read func(string) ([]byte, error), srcs ...source) error {
+	for _, src := range srcs {
+		if src.path != "" {
+			bs, err := read(src.path)
+			if err != nil {
+				return err
+			}
+			src.bs = bs
+			src.format = path.Ext(src.path)
+		}
+
+		doc, err := decode(src.bs, src.format)
+		if err != nil {
+			return err
+		}
+		if err := c.apply(doc); err != nil {
+			return err
+		}
+
+		if s.profile == "" {
+			continue
+		}
+		profiles, _ := doc[profilesKey].(map[string]interface{})
+		if profile, ok := profiles[s.profile].(map[string]interface{}); ok {
+			s.profileFound = true
+			if err := c.apply(profile); err != nil {
+				return fmt.Errorf("profile \"%s\": %s", s.profile, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// decode parses a config document into its generic form so that
+// overlays can tell which keys were actually set
+func decode(bs []byte, format string) (map[string]interface{}, error) {
+	doc := map[string]interface{}{}
+	switch "." + strings.TrimPrefix(format, ".") {
 	case ".json":
-		if err := json.Unmarshal(bs, &c); err != nil {
+		if err := json.Unmarshal(bs, &doc); err != nil {
 			return nil, err
 		}
 	case ".toml":
-		if _, err := toml.Decode(string(bs), &c); err != nil {
+		if _, err := toml.Decode(string(bs), &doc); err != nil {
+			return nil, err
+		}
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(bs, &doc); err != nil {
 			return nil, err
 		}
 	default:
-		return nil, fmt.Errorf("invalid extension: \"%s\"", path.Ext(p))
+		return nil, fmt.Errorf("invalid extension: \"%s\"", format)
 	}
+	return doc, nil
+}
 
-	conns := Conns{
-		c: &c,
+// apply merges a decoded document into c. Blocks are matched by id;
+// a matching block only has the keys present in doc overwritten,
+// everything else is appended as a new block
+func (c *Config) apply(doc map[string]interface{}) error {
+	for key, v := range doc {
+		items, ok := v.([]interface{})
+		if !ok {
+			// toml decodes arrays of tables as []map[string]interface{}
+			if ms, mok := v.([]map[string]interface{}); mok {
+				for _, m := range ms {
+					items = append(items, m)
+				}
+				ok = true
+			}
+		}
+		if key == profilesKey || !ok {
+			continue
+		}
+
+		for _, item := range items {
+			m, ok := item.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("invalid %s block: %v", key, item)
+			}
+			id, _ := m["id"].(string)
+			bs, err := json.Marshal(m)
+			if err != nil {
+				return err
+			}
+
+			var dst interface{}
+			switch key {
+			case "pq":
+				dst = c.pqBlock(id)
+			case "redis":
+				dst = c.redisBlock(id)
+			case "mongo":
+				dst = c.mongoBlock(id)
+			case "cockroachdb":
+				dst = c.roachBlock(id)
+			default:
+				continue
+			}
+			if err := json.Unmarshal(bs, dst); err != nil {
+				return fmt.Errorf("%s \"%s\": %s", key, id, err.Error())
+			}
+		}
 	}
-	// create indices
+	return nil
+}
+
+func (c *Config) pqBlock(id string) *PQConfig {
+	for _, b := range c.PQ {
+		if id != "" && b.ID == id {
+			return b
+		}
+	}
+	b := &PQConfig{}
+	c.PQ = append(c.PQ, b)
+	return b
+}
+
+func (c *Config) redisBlock(id string) *RedisConfig {
+	for _, b := range c.Redis {
+		if id != "" && b.ID == id {
+			return b
+		}
+	}
+	b := &RedisConfig{}
+	c.Redis = append(c.Redis, b)
+	return b
+}
+
+func (c *Config) mongoBlock(id string) *MongoConfig {
+	for _, b := range c.Mongo {
+		if id != "" && b.ID == id {
+			return b
+		}
+	}
+	b := &MongoConfig{}
+	c.Mongo = append(c.Mongo, b)
+	return b
+}
+
+func (c *Config) roachBlock(id string) *RoachConfig {
+	for _, b := range c.CockroachDB {
+		if id != "" && b.ID == id {
+			return b
+		}
+	}
+	b := &RoachConfig{}
+	c.CockroachDB = append(c.CockroachDB, b)
+	return b
+}
+
+// bind hands every block of c the shared state it needs while connecting
+func (conns *Conns) bind(c *Config) {
+	s := conns.s
+	for _, pc := range c.PQ {
+		pc.reset()
+		pc.secrets = s.secrets
+		pc.breaker = newBreaker(pc.BreakerFailures, pc.BreakerCooldownSeconds)
+		pc.tracer = s.tracer
+		pc.logger = s.logger
+		pc.creds = s.credentials[pc.ID]
+	}
+	for _, rc := range c.CockroachDB {
+		rc.reset()
+		rc.secrets = s.secrets
+		rc.breaker = newBreaker(rc.BreakerFailures, rc.BreakerCooldownSeconds)
+		rc.tracer = s.tracer
+		rc.logger = s.logger
+		rc.creds = s.credentials[rc.ID]
+	}
+	for _, rc := range c.Redis {
+		rc.reset()
+		rc.secrets = s.secrets
+		rc.breaker = newBreaker(rc.BreakerFailures, rc.BreakerCooldownSeconds)
+		rc.tracer = s.tracer
+		rc.logger = s.logger
+	}
+	for _, mc := range c.Mongo {
+		mc.reset()
+		mc.secrets = s.secrets
+		mc.breaker = newBreaker(mc.BreakerFailures, mc.BreakerCooldownSeconds)
+		mc.tracer = s.tracer
+		mc.logger = s.logger
+	}
+}
+
+// index maps every configured ID to its position in the backend slice
+func (conns *Conns) index() {
+	c := conns.c
+	conns.pqMap, conns.mongoMap, conns.redisMap, conns.roachMap = nil, nil, nil, nil
 	// Redis
 	if c.Redis != nil && len(c.Redis) > 0 {
 		if conns.redisMap == nil {
@@ -86,7 +425,6 @@ func New(p string) (*Conns, error) {
 			conns.roachMap[rc.ID] = i
 		}
 	}
-	return &conns, nil
 }
 
 // Config defines the overarching container for all supported databases
@@ -0,0 +1,270 @@
+package dbconnect
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestNewFormats(t *testing.T) {
+	type tt struct {
+		name string
+		path string
+		err  bool
+	}
+
+	tsts := []tt{
+		{name: "json", path: "testdata/config.json"},
+		{name: "toml", path: "testdata/config.toml"},
+		{name: "yaml", path: "testdata/config.yaml"},
+		{name: "unknown extension", path: "testdata/config.ini", err: true},
+	}
+
+	var want *Config
+	for _, tst := range tsts {
+		t.Run(tst.name, func(t *testing.T) {
+			conns, err := New(tst.path)
+			if err != nil {
+				if !tst.err {
+					t.Fatal(err)
+				}
+				return
+			} else if tst.err {
+				t.Fatal("was supposed to error")
+			}
+
+			if len(conns.pqMap) != 1 || len(conns.mongoMap) != 1 ||
+				len(conns.redisMap) != 1 || len(conns.roachMap) != 1 {
+				t.Fatal("indices were not built for every backend")
+			}
+
+			if want == nil {
+				want = conns.c
+				return
+			}
+			if !reflect.DeepEqual(want, conns.c) {
+				t.Fatalf("%s decoded differently than json", tst.name)
+			}
+		})
+	}
+}
+
+func TestNewFromSources(t *testing.T) {
+	type tt struct {
+		name string
+		new  func() (*Conns, error)
+		err  bool
+	}
+
+	bs, err := os.ReadFile("testdata/config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tsts := []tt{
+		{
+			name: "reader",
+			new: func() (*Conns, error) {
+				return NewFromReader(bytes.NewReader(bs), "yaml")
+			},
+		},
+		{
+			name: "reader with dotted format",
+			new: func() (*Conns, error) {
+				return NewFromReader(bytes.NewReader(bs), ".yml")
+			},
+		},
+		{
+			name: "reader with unknown format",
+			new: func() (*Conns, error) {
+				return NewFromReader(bytes.NewReader(bs), "xml")
+			},
+			err: true,
+		},
+		{
+			name: "fs",
+			new: func() (*Conns, error) {
+				return NewFromFS(fstest.MapFS{"conf/db.yaml": {Data: bs}}, "conf/db.yaml")
+			},
+		},
+		{
+			name: "config",
+			new: func() (*Conns, error) {
+				return NewFromConfig(&Config{
+					PQ:          []*PQConfig{{ID: "main", Host: "localhost", User: "postgres", DB: "app"}},
+					Mongo:       []*MongoConfig{{ID: "docs"}},
+					Redis:       []*RedisConfig{{ID: "cache", Host: "localhost"}},
+					CockroachDB: []*RoachConfig{{ID: "roach", Host: "localhost", User: "root", DB: "defaultdb"}},
+				})
+			},
+		},
+		{
+			name: "nil config",
+			new: func() (*Conns, error) {
+				return NewFromConfig(nil)
+			},
+			err: true,
+		},
+	}
+
+	for _, tst := range tsts {
+		t.Run(tst.name, func(t *testing.T) {
+			conns, err := tst.new()
+			if err != nil {
+				if !tst.err {
+					t.Fatal(err)
+				}
+				return
+			} else if tst.err {
+				t.Fatal("was supposed to error")
+			}
+
+			for m, id := range map[*map[string]int]string{
+				&conns.pqMap:    "main",
+				&conns.mongoMap: "docs",
+				&conns.redisMap: "cache",
+				&conns.roachMap: "roach",
+			} {
+				if _, ok := (*m)[id]; !ok {
+					t.Fatalf("no index for ID: %s", id)
+				}
+			}
+		})
+	}
+}
+
+func TestOverlays(t *testing.T) {
+	type tt struct {
+		name    string
+		opts    []Option
+		env     string
+		host    string
+		sslmode string
+		err     bool
+	}
+
+	tsts := []tt{
+		{
+			name:    "base only",
+			host:    "localhost",
+			sslmode: "disable",
+		},
+		{
+			name:    "overlay",
+			opts:    []Option{WithOverlays("testdata/overlay.yaml")},
+			host:    "staging-db",
+			sslmode: "disable",
+		},
+		{
+			name:    "overlay with profile",
+			opts:    []Option{WithOverlays("testdata/overlay.yaml"), WithProfile("prod")},
+			host:    "prod-db",
+			sslmode: "verify-full",
+		},
+		{
+			name:    "profile from env",
+			opts:    []Option{WithOverlays("testdata/overlay.yaml")},
+			env:     "prod",
+			host:    "prod-db",
+			sslmode: "verify-full",
+		},
+		{
+			name: "unknown profile",
+			opts: []Option{WithOverlays("testdata/overlay.yaml"), WithProfile("dev")},
+			err:  true,
+		},
+	}
+
+	for _, tst := range tsts {
+		t.Run(tst.name, func(t *testing.T) {
+			t.Setenv(ProfileEnv, tst.env)
+			conns, err := New("testdata/config.toml", tst.opts...)
+			if err != nil {
+				if !tst.err {
+					t.Fatal(err)
+				}
+				return
+			} else if tst.err {
+				t.Fatal("was supposed to error")
+			}
+
+			pc := conns.c.PQ[conns.pqMap["main"]]
+			if pc.Host != tst.host || pc.SSLMode != tst.sslmode {
+				t.Fatalf("got host=%s sslmode=%s", pc.Host, pc.SSLMode)
+			}
+			// keys not present in any overlay are kept from the base
+			if pc.User != "postgres" || pc.Port != 5432 {
+				t.Fatalf("base keys were overwritten: user=%s port=%d", pc.User, pc.Port)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	type tt struct {
+		name     string
+		c        *Config
+		problems []string
+	}
+
+	tsts := []tt{
+		{
+			name: "valid without defaults applied",
+			c: &Config{
+				PQ:          []*PQConfig{{ID: "main", Host: "localhost", User: "postgres", DB: "app"}},
+				CockroachDB: []*RoachConfig{{ID: "roach", Host: "localhost", User: "root", DB: "defaultdb"}},
+				Redis:       []*RedisConfig{{ID: "cache", Host: "localhost"}},
+				Mongo:       []*MongoConfig{{ID: "docs"}},
+			},
+		},
+		{
+			name: "every problem is reported",
+			c: &Config{
+				PQ: []*PQConfig{
+					{ID: "main", Host: "localhost", User: "postgres", DB: "app", SSLMode: "sometimes"},
+					{ID: "main", Host: "localhost", User: "postgres", DB: "app", Port: 70000},
+					{Host: "localhost", User: "postgres", DB: "app", SSLRootCert: "testdata/missing.pem"},
+				},
+				Redis: []*RedisConfig{{ID: "cache", Host: "localhost", Network: "udp"}},
+				Mongo: []*MongoConfig{{ID: "docs", Port: -1}},
+			},
+			problems: []string{
+				`pq "main": invalid sslmode: sometimes`,
+				`pq "main": duplicate id`,
+				`pq "main": invalid port: 70000`,
+				`pq "": empty id`,
+				`pq "": sslrootcert: stat testdata/missing.pem: no such file or directory`,
+				`redis "cache": invalid network: udp`,
+				`mongo "docs": invalid port: -1`,
+			},
+		},
+	}
+
+	for _, tst := range tsts {
+		t.Run(tst.name, func(t *testing.T) {
+			err := tst.c.Validate()
+			if len(tst.problems) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			ve, ok := err.(*ValidationError)
+			if !ok {
+				t.Fatalf("expected *ValidationError, got %v", err)
+			}
+			var got []string
+			for _, p := range ve.Problems {
+				got = append(got, p.String())
+			}
+			if !reflect.DeepEqual(got, tst.problems) {
+				t.Fatalf("got problems:\n%s\nwant:\n%s",
+					strings.Join(got, "\n"), strings.Join(tst.problems, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package dbconnect
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// connState tracks the lifecycle of a single pool or client. Unlike a
+// sync.Once, a failed connect isn't cached: the next call tries again.
+// Concurrent callers share the attempt in flight instead of starting
+// their own
+type connState struct {
+	mu        sync.Mutex
+	connected bool
+	closed    bool
+	inflight  *attempt
+	// connectedAt is when the successful attempt finished
+	connectedAt time.Time
+}
+
+// handle is the runtime side of a block: its connState and, once
+// connected, its pool or client. Configs only point to their handle, so
+// copying a config copies neither a lock nor state a connect writes to
+type handle[T any] struct {
+	connState
+	conn T
+}
+
+// attempt is a single connect in flight; err is valid once done is closed
+type attempt struct {
+	done chan struct{}
+	err  error
+}
+
+// connect runs fn unless a previous attempt succeeded. Callers arriving
+// while an attempt is in flight wait for it and get its result
+func (s *connState) connect(fn func() error) error {
+	return s.connectContext(context.Background(), fn)
+}
+
+// connectContext is connect bounded by ctx. The attempt itself runs
+// detached from ctx: a caller giving up only stops waiting, the attempt
+// carries on for the other callers and its result is kept as usual
+func (s *connState) connectContext(ctx context.Context, fn func() error) error {
+	s.mu.Lock()
+	switch {
+	case s.closed:
+		s.mu.Unlock()
+		return ErrClosed
+	case s.connected:
+		s.mu.Unlock()
+		return nil
+	}
+
+	a := s.inflight
+	if a == nil {
+		a = &attempt{done: make(chan struct{})}
+		s.inflight = a
+		go s.run(a, fn)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-a.done:
+		return a.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run executes the attempt a and records its result
+func (s *connState) run(a *attempt, fn func() error) {
+	a.err = fn()
+
+	s.mu.Lock()
+	s.inflight = nil
+	s.connected = a.err == nil
+	if s.connected {
+		s.connectedAt = time.Now()
+	}
+	s.mu.Unlock()
+	close(a.done)
+}
+
+// isConnected reports whether an attempt succeeded and the state wasn't closed since
+func (s *connState) isConnected() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connected && !s.closed
+}
+
+// since returns when the connect succeeded; zero when it didn't yet
+func (s *connState) since() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connectedAt
+}
+
+// close marks the state closed so every later connect returns ErrClosed,
+// then runs fn if a connection was made. An attempt in flight is waited
+// for until ctx is done; fn then runs in the background once the attempt
+// finishes and ctx.Err() is returned
+func (s *connState) close(ctx context.Context, fn func() error) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	a := s.inflight
+	s.mu.Unlock()
+
+	if a != nil {
+		select {
+		case <-a.done:
+		case <-ctx.Done():
+			go func() {
+				<-a.done
+				_ = s.release(fn)
+			}()
+			return ctx.Err()
+		}
+	}
+	return s.release(fn)
+}
+
+// release runs fn if a connection was made
+func (s *connState) release(fn func() error) error {
+	s.mu.Lock()
+	connected := s.connected
+	s.mu.Unlock()
+	if !connected {
+		return nil
+	}
+	return fn()
+}
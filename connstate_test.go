@@ -0,0 +1,119 @@
+package dbconnect
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConnStateRetry(t *testing.T) {
+	var s connState
+	var calls int32
+	errDown := errors.New("database is down")
+
+	fn := func() error {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return errDown
+		}
+		return nil
+	}
+
+	if err := s.connect(fn); err != errDown {
+		t.Fatalf("got %v, want %v", err, errDown)
+	}
+	if s.isConnected() {
+		t.Fatal("failed attempt marked as connected")
+	}
+	// the failure isn't cached; the next call connects
+	if err := s.connect(fn); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.connect(fn); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Fatalf("got %d connect attempts, want 2", calls)
+	}
+}
+
+func TestConnStateShared(t *testing.T) {
+	var s connState
+	var calls int32
+	release := make(chan struct{})
+
+	fn := func() error {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.connect(fn); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Fatalf("got %d connect attempts, want 1", calls)
+	}
+}
+
+func TestConnStateClose(t *testing.T) {
+	var s connState
+	var closed bool
+
+	if err := s.connect(func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.close(context.Background(), func() error { closed = true; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if !closed {
+		t.Fatal("connected state was not closed")
+	}
+	if err := s.connect(func() error { return nil }); err != ErrClosed {
+		t.Fatalf("got %v, want ErrClosed", err)
+	}
+}
+
+func TestConnStateContext(t *testing.T) {
+	var s connState
+	var calls int32
+	release := make(chan struct{})
+
+	fn := func() error {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.connectContext(ctx, fn); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// the attempt outlives the caller that started it and is shared
+	// with the next one
+	close(release)
+	if err := s.connect(fn); err != nil {
+		t.Fatal(err)
+	}
+	if !s.isConnected() {
+		t.Fatal("attempt was aborted with its caller")
+	}
+	if calls != 1 {
+		t.Fatalf("got %d connect attempts, want 1", calls)
+	}
+}
@@ -0,0 +1,75 @@
+package dbconnect
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Credentials are the user and password of a single database connection
+type Credentials struct {
+	// User overrides the configured user when not empty
+	User     string
+	Password string
+}
+
+// CredentialProvider returns the credentials for a new connection of the
+// postgresql or cockroachdb block with the given id. It is asked every time
+// a pool opens a physical connection, so rotated credentials are picked up
+// without a restart; connections already open keep theirs
+type CredentialProvider interface {
+	Credentials(ctx context.Context, backend, id string) (Credentials, error)
+}
+
+// CredentialProviderFunc adapts a plain function to a CredentialProvider
+type CredentialProviderFunc func(ctx context.Context, backend, id string) (Credentials, error)
+
+// Credentials calls f(ctx, backend, id)
+func (f CredentialProviderFunc) Credentials(ctx context.Context, backend, id string) (Credentials, error) {
+	return f(ctx, backend, id)
+}
+
+// WithCredentialProvider sets the provider asked for the credentials of
+// every new connection of the postgresql and cockroachdb blocks with id.
+// Without a provider, a pwd that refers to a secret is resolved again for
+// every new connection, so a rotated secret file or env variable is
+// picked up the same way
+func WithCredentialProvider(id string, p CredentialProvider) Option {
+	return func(s *settings) {
+		if s.credentials == nil {
+			s.credentials = map[string]CredentialProvider{}
+		}
+		s.credentials[id] = p
+	}
+}
+
+// beforeConnect returns the pgxpool BeforeConnect hook that sets the
+// current credentials of b on every new connection; nil when neither a
+// provider is set nor pwd refers to a secret, i.e. they can't change
+func beforeConnect(b block, p CredentialProvider, sec *secrets, pwd string) func(context.Context, *pgx.ConnConfig) error {
+	if p == nil && !isSecret(pwd) {
+		return nil
+	}
+
+	return func(ctx context.Context, cc *pgx.ConnConfig) error {
+		if p == nil {
+			v, err := sec.resolve(ctx, pwd)
+			if err != nil {
+				return fmt.Errorf("pwd: %s", err.Error())
+			}
+			cc.Password = v
+			return nil
+		}
+
+		creds, err := p.Credentials(ctx, b.backend(), b.ident())
+		if err != nil {
+			return fmt.Errorf("credentials: %s", err.Error())
+		}
+		if creds.User != "" {
+			cc.User = creds.User
+		}
+		cc.Password = creds.Password
+		return nil
+	}
+}
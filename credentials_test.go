@@ -0,0 +1,78 @@
+package dbconnect
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestBeforeConnect(t *testing.T) {
+	pc := &PQConfig{ID: "main", User: "app", Pwd: "plain"}
+	if beforeConnect(pc, nil, nil, pc.Pwd) != nil {
+		t.Fatal("a plain pwd can't rotate; no hook expected")
+	}
+
+	// a rotated secret file is read again for the next connection
+	f := filepath.Join(t.TempDir(), "pg")
+	hook := beforeConnect(pc, nil, nil, "secret://file"+f)
+	for _, pwd := range []string{"first", "rotated"} {
+		if err := os.WriteFile(f, []byte(pwd+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		var cc pgx.ConnConfig
+		if err := hook(context.Background(), &cc); err != nil {
+			t.Fatal(err)
+		}
+		if cc.Password != pwd {
+			t.Fatalf("got password %q, want %q", cc.Password, pwd)
+		}
+	}
+
+	calls := 0
+	p := CredentialProviderFunc(func(_ context.Context, backend, id string) (Credentials, error) {
+		calls++
+		if backend != "pq" || id != "main" {
+			t.Errorf("asked for the credentials of %s %s", backend, id)
+		}
+		if calls > 1 {
+			return Credentials{}, errors.New("vault sealed")
+		}
+		return Credentials{User: "app-v2", Password: "s3cret"}, nil
+	})
+	hook = beforeConnect(pc, p, nil, pc.Pwd)
+	cc := pgx.ConnConfig{}
+	cc.User = "app"
+	if err := hook(context.Background(), &cc); err != nil {
+		t.Fatal(err)
+	}
+	if cc.User != "app-v2" || cc.Password != "s3cret" {
+		t.Fatalf("got %s:%s, want the provider's credentials", cc.User, cc.Password)
+	}
+	if err := hook(context.Background(), &cc); err == nil {
+		t.Fatal("provider error was dropped")
+	}
+}
+
+func TestWithCredentialProvider(t *testing.T) {
+	p := CredentialProviderFunc(func(context.Context, string, string) (Credentials, error) {
+		return Credentials{}, nil
+	})
+	conns, err := Build(
+		WithPostgres("main", &PQConfig{Host: "localhost", User: "app", DB: "app"}),
+		WithRoach("reports", &RoachConfig{Host: "localhost", User: "app", DB: "app"}),
+		WithCredentialProvider("main", p),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pc, _ := conns.pq("main")
+	rc, _ := conns.roach("reports")
+	if pc.creds == nil || rc.creds != nil {
+		t.Fatal("provider was not bound to main only")
+	}
+}
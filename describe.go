@@ -0,0 +1,244 @@
+package dbconnect
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// masked replaces secrets in everything dbconnect shows or logs
+const masked = "*****"
+
+// maskSecrets builds connection strings with every credential masked
+var maskSecrets = &secrets{mask: true}
+
+// Description is the effective configuration of a single block, after
+// env expansion and defaults, with all secrets masked
+type Description struct {
+	Backend string `json:"backend"`
+	ID      string `json:"id"`
+	// Settings holds every config key of the block
+	Settings map[string]interface{} `json:"settings"`
+	// ConnString is the connection string or address dbconnect dials
+	ConnString string `json:"conn_string"`
+}
+
+// Describe returns the effective settings of every configured block.
+// Passwords, and passwords embedded in connection strings, are masked;
+// secret references are shown as written
+func (c *Conns) Describe() []Description {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var ds []Description
+	for _, b := range c.c.blocks() {
+		ds = append(ds, Description{
+			Backend:    b.backend(),
+			ID:         b.ident(),
+			Settings:   b.redacted(),
+			ConnString: b.preview(),
+		})
+	}
+	return ds
+}
+
+// describable is implemented by every backend config
+type describable interface {
+	block
+	redacted() map[string]interface{}
+	preview() string
+}
+
+// blocks returns every block of c in a stable order
+func (c *Config) blocks() []describable {
+	var bs []describable
+	for _, pc := range c.PQ {
+		bs = append(bs, pc)
+	}
+	for _, rc := range c.CockroachDB {
+		bs = append(bs, rc)
+	}
+	for _, rc := range c.Redis {
+		bs = append(bs, rc)
+	}
+	for _, mc := range c.Mongo {
+		bs = append(bs, mc)
+	}
+	return bs
+}
+
+// MarshalJSON encodes the config with pwd masked
+func (pc PQConfig) MarshalJSON() ([]byte, error) {
+	return json.Marshal(pc.redacted())
+}
+
+// String returns the config as JSON with pwd masked
+func (pc PQConfig) String() string {
+	return jsonString(pc)
+}
+
+func (pc *PQConfig) redacted() map[string]interface{} {
+	m := fields(pc)
+	maskField(m, "pwd", maskValue)
+	return m
+}
+
+func (pc *PQConfig) preview() string {
+	cs, err := pc.connString(context.Background(), maskSecrets)
+	if err != nil {
+		return ""
+	}
+	return cs
+}
+
+// MarshalJSON encodes the config with pwd masked
+func (rc RoachConfig) MarshalJSON() ([]byte, error) {
+	return json.Marshal(rc.redacted())
+}
+
+// String returns the config as JSON with pwd masked
+func (rc RoachConfig) String() string {
+	return jsonString(rc)
+}
+
+func (rc *RoachConfig) redacted() map[string]interface{} {
+	m := fields(rc)
+	maskField(m, "pwd", maskValue)
+	return m
+}
+
+func (rc *RoachConfig) preview() string {
+	cs, err := rc.connString(context.Background(), maskSecrets)
+	if err != nil {
+		return ""
+	}
+	return cs
+}
+
+// MarshalJSON encodes the config with pwd and any password in raw_url masked
+func (rc RedisConfig) MarshalJSON() ([]byte, error) {
+	return json.Marshal(rc.redacted())
+}
+
+// String returns the config as JSON with pwd and any password in raw_url masked
+func (rc RedisConfig) String() string {
+	return jsonString(rc)
+}
+
+func (rc *RedisConfig) redacted() map[string]interface{} {
+	m := fields(rc)
+	maskField(m, "pwd", maskValue)
+	maskField(m, "raw_url", maskURL)
+	return m
+}
+
+func (rc *RedisConfig) preview() string {
+	if rc.Addr() == "" {
+		return maskURL(rc.RawURL)
+	}
+	return fmt.Sprintf("%s://%s/%d", rc.Network, rc.Addr(), rc.DB)
+}
+
+// MarshalJSON encodes the config with pwd and any password in
+// connectionString masked
+func (mc MongoConfig) MarshalJSON() ([]byte, error) {
+	return json.Marshal(mc.redacted())
+}
+
+// String returns the config as JSON with pwd and any password in
+// connectionString masked
+func (mc MongoConfig) String() string {
+	return jsonString(mc)
+}
+
+func (mc *MongoConfig) redacted() map[string]interface{} {
+	m := fields(mc)
+	maskField(m, "pwd", maskValue)
+	maskField(m, "connectionString", maskURL)
+	return m
+}
+
+func (mc *MongoConfig) preview() string {
+	if mc.ConnectionString != "" {
+		return maskURL(mc.ConnectionString)
+	}
+	uri, err := mc.uri(context.Background(), maskSecrets)
+	if err != nil {
+		return ""
+	}
+	return uri
+}
+
+func jsonString(v json.Marshaler) string {
+	bs, err := v.MarshalJSON()
+	if err != nil {
+		return fmt.Sprintf("%%!(dbconnect: %s)", err.Error())
+	}
+	return string(bs)
+}
+
+// fields returns the exported fields of the struct v points to, keyed by
+// their json name. Fields tagged omitempty are left out when empty
+func fields(v interface{}) map[string]interface{} {
+	rv := reflect.ValueOf(v).Elem()
+	rt := rv.Type()
+	m := map[string]interface{}{}
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if strings.Contains(opts, "omitempty") && rv.Field(i).IsZero() {
+			continue
+		}
+		m[name] = rv.Field(i).Interface()
+	}
+	return m
+}
+
+func maskField(m map[string]interface{}, key string, mask func(string) string) {
+	if v, ok := m[key].(string); ok {
+		m[key] = mask(v)
+	}
+}
+
+// maskValue masks a plain secret; empty values and secret references
+// carry nothing sensitive and are kept
+func maskValue(v string) string {
+	if v == "" || isSecret(v) {
+		return v
+	}
+	return masked
+}
+
+// passwordParam matches password like parameters in URL query strings
+var passwordParam = regexp.MustCompile(`(?i)((?:password|pwd)=)[^&]*`)
+
+// maskURL masks the password in the user info and query of a URL.
+// A value that can't be parsed is masked as a whole
+func maskURL(raw string) string {
+	if raw == "" || isSecret(raw) {
+		return raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return masked
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), masked)
+	}
+	u.RawQuery = passwordParam.ReplaceAllString(u.RawQuery, "${1}"+masked)
+	// keep the placeholder readable instead of percent encoded
+	return strings.ReplaceAll(u.String(), url.QueryEscape(masked), masked)
+}
@@ -0,0 +1,142 @@
+package dbconnect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// drainPoll is how often Drain checks whether connections were released
+const drainPoll = 50 * time.Millisecond
+
+// DrainError lists every block that still had connections in use when the
+// drain timed out, and every block that failed to close
+type DrainError struct {
+	Problems Problems
+}
+
+func (de *DrainError) Error() string {
+	return de.Problems.join("drain")
+}
+
+// Drain shuts c down gracefully. Getter calls fail with ErrDraining right
+// away; Drain then waits until every acquired postgresql and cockroachdb
+// connection, redis conn and mongo connection is released, or ctx is done,
+// and closes everything. Pools still in use when ctx is done, or that
+// don't close in time, are closed in the background, once released, and
+// reported in a *DrainError
+func (c *Conns) Drain(ctx context.Context) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return &Error{Kind: ErrClosed}
+	}
+	c.draining = true
+	c.mu.Unlock()
+
+	c.waitIdle(ctx)
+	bs, ok := c.shutdown()
+	if !ok {
+		return &Error{Kind: ErrClosed}
+	}
+
+	var de DrainError
+	var idle []block
+	for _, b := range bs {
+		if !b.opened() {
+			// nothing to release; a connect still in flight is closed in
+			// the background once it is done
+			go func(b block) {
+				_ = b.close(context.Background())
+			}(b)
+			continue
+		}
+		n := b.inUse()
+		if n == 0 {
+			idle = append(idle, b)
+			continue
+		}
+		de.Problems = append(de.Problems, Problem{
+			Backend: b.backend(),
+			ID:      b.ident(),
+			Err:     fmt.Errorf("%d connections still in use", n),
+		})
+		go func(b block) {
+			_ = b.close(context.Background())
+		}(b)
+	}
+
+	// a pool handed out before the drain can still be used, and closing a
+	// pgxpool waits for its connections to be released; idle pools get
+	// until ctx is done, or drainPoll if it already is
+	cctx := ctx
+	if ctx.Err() != nil {
+		var cancel context.CancelFunc
+		cctx, cancel = context.WithTimeout(context.Background(), drainPoll)
+		defer cancel()
+	}
+	var ce *CloseError
+	if err := closeBlocks(cctx, idle); errors.As(err, &ce) {
+		de.Problems = append(de.Problems, ce.Problems...)
+	}
+	return de.Problems.orNil(&de)
+}
+
+// waitIdle returns once no block of c has connections in use, or ctx is done
+func (c *Conns) waitIdle(ctx context.Context) {
+	t := time.NewTicker(drainPoll)
+	defer t.Stop()
+	for !c.idle() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// idle reports whether no block of c has connections in use
+func (c *Conns) idle() bool {
+	c.mu.RLock()
+	all := c.c.blocks()
+	c.mu.RUnlock()
+	for _, b := range all {
+		if b.inUse() > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// DrainOnSignal waits for one of signals, SIGINT or SIGTERM when none are
+// given, and then drains c with Drain, giving in-flight work up to timeout
+// to finish. It returns the result of Drain, or ctx.Err() when ctx is done
+// before a signal arrives. Run it in its own goroutine:
+//
+//	go func() {
+//		if err := conns.DrainOnSignal(ctx, 10*time.Second); err != nil {
+//			log.Println(err)
+//		}
+//	}()
+func (c *Conns) DrainOnSignal(ctx context.Context, timeout time.Duration, signals ...os.Signal) error {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+	defer signal.Stop(ch)
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-ch:
+	}
+
+	dctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return c.Drain(dctx)
+}
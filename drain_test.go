@@ -0,0 +1,101 @@
+package dbconnect
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDrain(t *testing.T) {
+	addr := listen(t)
+	conns, err := Build(WithRedis("cache", &RedisConfig{Host: "127.0.0.1", Port: addr.Port}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := conns.GetRedisConnContext(context.Background(), "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(100*time.Millisecond, func() { conn.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- conns.Drain(ctx) }()
+
+	time.Sleep(20 * time.Millisecond)
+	if _, err := conns.GetRedisPool("cache"); !errors.Is(err, ErrDraining) {
+		t.Fatalf("got %v while draining, want ErrDraining", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conns.GetRedisPool("cache"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("got %v after draining, want ErrClosed", err)
+	}
+	if err := conns.Drain(ctx); !errors.Is(err, ErrClosed) {
+		t.Fatalf("got %v, want ErrClosed", err)
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	addr := listen(t)
+	conns, err := Build(
+		WithRedis("cache", &RedisConfig{Host: "127.0.0.1", Port: addr.Port}),
+		WithRedis("sessions", &RedisConfig{Host: "127.0.0.1", Port: addr.Port}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := conns.GetRedisConnContext(context.Background(), "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conns.GetRedisPool("sessions"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var de *DrainError
+	if err := conns.Drain(ctx); !errors.As(err, &de) {
+		t.Fatalf("got %v, want *DrainError", err)
+	}
+	if len(de.Problems) != 1 || de.Problems[0].ID != "cache" {
+		t.Fatalf("got %v, want cache still in use", de.Problems)
+	}
+}
+
+func TestDrainOnSignal(t *testing.T) {
+	conns, err := Build(WithRedis("cache", &RedisConfig{Host: "127.0.0.1"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := conns.DrainOnSignal(ctx, time.Second); err != context.Canceled {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+	if _, err := conns.GetRedisPool("cache"); err != nil {
+		t.Fatalf("drained without a signal: %v", err)
+	}
+}
+
+func TestDrainConnecting(t *testing.T) {
+	conns := connecting(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := conns.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("Drain took %v with a 100ms deadline", d)
+	}
+}
@@ -0,0 +1,83 @@
+package dbconnect
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrClosed is returned by the getters once Conns.Close, or
+	// Conns.CloseID for the requested id, has been called
+	ErrClosed = errors.New("dbconnect: connection closed")
+	// ErrUnknownID is returned when no block of the requested backend has the given id
+	ErrUnknownID = errors.New("dbconnect: unknown id")
+	// ErrNoConfig is returned when no block of the requested backend was configured
+	ErrNoConfig = errors.New("dbconnect: no configuration")
+	// ErrInvalidConfig is returned for a block that can't be connected
+	// because of its settings. *ValidationError matches it as well
+	ErrInvalidConfig = errors.New("dbconnect: invalid configuration")
+	// ErrConnect is returned when the driver failed to connect; the
+	// driver error is available through errors.As / errors.Unwrap
+	ErrConnect = errors.New("dbconnect: connect failed")
+	// ErrCircuitOpen is returned while the circuit breaker of a block is
+	// open, by the getters and by new connections of pools already handed out
+	ErrCircuitOpen = errors.New("dbconnect: circuit open")
+	// ErrDraining is returned by the getters once Conns.Drain has started
+	ErrDraining = errors.New("dbconnect: draining")
+)
+
+// Error is returned by the getters. Kind is one of the Err* sentinels
+// and matches with errors.Is; Err is the underlying cause, if any
+type Error struct {
+	Backend string
+	ID      string
+	Kind    error
+	Err     error
+}
+
+func (e *Error) Error() string {
+	msg := strings.TrimPrefix(e.Kind.Error(), "dbconnect: ")
+	if e.Err != nil {
+		msg = fmt.Sprintf("%s: %s", msg, e.Err.Error())
+	}
+	var who []string
+	if e.Backend != "" {
+		who = append(who, e.Backend)
+	}
+	if e.ID != "" {
+		who = append(who, fmt.Sprintf("\"%s\"", e.ID))
+	}
+	if len(who) == 0 {
+		return "dbconnect: " + msg
+	}
+	return fmt.Sprintf("dbconnect: %s: %s", strings.Join(who, " "), msg)
+}
+
+// Is reports whether target is the kind of e
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// Unwrap returns the underlying cause
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// blockError returns an *Error of the given kind for b. A cause that
+// already is an *Error, or is ErrClosed, is returned as such
+func blockError(b block, kind, err error) error {
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	if err == ErrClosed {
+		return &Error{Backend: b.backend(), ID: b.ident(), Kind: ErrClosed}
+	}
+	return &Error{Backend: b.backend(), ID: b.ident(), Kind: kind, Err: err}
+}
+
+// Is makes a *ValidationError match ErrInvalidConfig
+func (ve *ValidationError) Is(target error) bool {
+	return target == ErrInvalidConfig
+}
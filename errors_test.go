@@ -0,0 +1,80 @@
+package dbconnect
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestErrors(t *testing.T) {
+	type tt struct {
+		name string
+		call func(c *Conns) error
+		kind error
+		msg  string
+	}
+
+	conns, err := Build(
+		WithPostgres("main", downPQ(&PQConfig{})),
+		WithMongo("docs", &MongoConfig{}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tsts := []tt{
+		{
+			name: "unknown id",
+			call: func(c *Conns) error { _, err := c.GetPQ("reports"); return err },
+			kind: ErrUnknownID,
+			msg:  `dbconnect: pq "reports": unknown id`,
+		},
+		{
+			name: "no config",
+			call: func(c *Conns) error { _, err := c.GetRedisPool("cache"); return err },
+			kind: ErrNoConfig,
+			msg:  `dbconnect: redis: no configuration`,
+		},
+		{
+			name: "invalid config",
+			call: func(c *Conns) error { _, err := c.GetMongoDB(context.Background(), "docs"); return err },
+			kind: ErrInvalidConfig,
+			msg:  `dbconnect: mongo "docs": invalid configuration: empty database name`,
+		},
+		{
+			name: "connect",
+			call: func(c *Conns) error { _, err := c.GetPQ("main"); return err },
+			kind: ErrConnect,
+		},
+	}
+
+	for _, tst := range tsts {
+		t.Run(tst.name, func(t *testing.T) {
+			err := tst.call(conns)
+			if !errors.Is(err, tst.kind) {
+				t.Fatalf("got %v, want %v", err, tst.kind)
+			}
+			var e *Error
+			if !errors.As(err, &e) {
+				t.Fatalf("got %T, want *Error", err)
+			}
+			if tst.msg != "" && err.Error() != tst.msg {
+				t.Fatalf("got %s, want %s", err.Error(), tst.msg)
+			}
+			if tst.kind == ErrConnect && errors.Unwrap(err) == nil {
+				t.Fatal("driver cause is missing")
+			}
+		})
+	}
+
+	// a block that can't be connected doesn't take the process down
+	rc := &RedisConfig{ID: "cache"}
+	rc.reset()
+	if _, err := rc.pool(); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("got %v, want ErrInvalidConfig", err)
+	}
+
+	if _, err := NewFromConfig(&Config{Redis: []*RedisConfig{{}}}); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("got %v, want ErrInvalidConfig", err)
+	}
+}
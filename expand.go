@@ -0,0 +1,141 @@
+package dbconnect
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// expand replaces environment variable references in s, following the
+// shell conventions:
+//
+//	$VAR, ${VAR}       value of VAR, empty when unset
+//	${VAR:-default}    value of VAR, default when unset or empty
+//	${VAR:?message}    value of VAR, an error carrying message when unset or empty
+//	$$                 a literal $
+//
+// A $ that doesn't start a reference is kept as is
+func expand(s string) (string, error) {
+	if !strings.Contains(s, "$") {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		switch next := s[i+1]; {
+		case next == '$':
+			b.WriteByte('$')
+			i++
+		case next == '{':
+			end := closingBrace(s, i+2)
+			if end < 0 {
+				return "", fmt.Errorf("unterminated variable reference: %s", s[i:])
+			}
+			v, err := expandBraced(s[i+2 : end])
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(v)
+			i = end
+		case isNameStart(next):
+			j := i + 2
+			for j < len(s) && isNameChar(s[j]) {
+				j++
+			}
+			b.WriteString(os.Getenv(s[i+1 : j]))
+			i = j - 1
+		default:
+			b.WriteByte('$')
+		}
+	}
+	return b.String(), nil
+}
+
+// expandBraced resolves the inside of a ${...} reference
+func expandBraced(ref string) (string, error) {
+	name, op, arg := ref, "", ""
+	if i := strings.Index(ref, ":"); i >= 0 && i+1 < len(ref) {
+		name, op, arg = ref[:i], ref[i:i+2], ref[i+2:]
+	}
+	if !isName(name) {
+		return "", fmt.Errorf("invalid variable reference: ${%s}", ref)
+	}
+
+	v := os.Getenv(name)
+	switch op {
+	case "":
+		return v, nil
+	case ":-":
+		if v != "" {
+			return v, nil
+		}
+		return expand(arg)
+	case ":?":
+		if v != "" {
+			return v, nil
+		}
+		if arg == "" {
+			arg = "not set"
+		}
+		return "", fmt.Errorf("%s: %s", name, arg)
+	default:
+		return "", fmt.Errorf("invalid variable reference: ${%s}", ref)
+	}
+}
+
+// closingBrace returns the index of the } closing a reference opened
+// before start, allowing nested references in defaults
+func closingBrace(s string, start int) int {
+	depth := 1
+	for i := start; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func isName(s string) bool {
+	if s == "" || !isNameStart(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isNameChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || '0' <= c && c <= '9'
+}
+
+// expander expands a series of fields, collecting an error per field
+type expander struct {
+	errs []error
+}
+
+func (e *expander) expand(field string, v *string) {
+	s, err := expand(*v)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: %s", field, err.Error()))
+		return
+	}
+	*v = s
+}
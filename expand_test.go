@@ -0,0 +1,71 @@
+package dbconnect
+
+import (
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	type tt struct {
+		name string
+		s    string
+		want string
+		err  bool
+	}
+
+	t.Setenv("DBC_TEST_HOST", "db.internal")
+	t.Setenv("DBC_TEST_EMPTY", "")
+
+	tsts := []tt{
+		{name: "no reference", s: "localhost", want: "localhost"},
+		{name: "plain", s: "$DBC_TEST_HOST:5432", want: "db.internal:5432"},
+		{name: "braced", s: "${DBC_TEST_HOST}-replica", want: "db.internal-replica"},
+		{name: "unset", s: "${DBC_TEST_UNSET}", want: ""},
+		{name: "default unused", s: "${DBC_TEST_HOST:-localhost}", want: "db.internal"},
+		{name: "default", s: "${DBC_TEST_UNSET:-localhost}", want: "localhost"},
+		{name: "default on empty", s: "${DBC_TEST_EMPTY:-localhost}", want: "localhost"},
+		{name: "nested default", s: "${DBC_TEST_UNSET:-${DBC_TEST_HOST}}", want: "db.internal"},
+		{name: "required set", s: "${DBC_TEST_HOST:?host is required}", want: "db.internal"},
+		{name: "required unset", s: "${DBC_TEST_UNSET:?host is required}", err: true},
+		{name: "escape", s: "pa$$word", want: "pa$word"},
+		{name: "lone dollar", s: "pa$-word$", want: "pa$-word$"},
+		{name: "unterminated", s: "${DBC_TEST_HOST", err: true},
+		{name: "invalid name", s: "${1abc}", err: true},
+	}
+
+	for _, tst := range tsts {
+		t.Run(tst.name, func(t *testing.T) {
+			got, err := expand(tst.s)
+			if err != nil {
+				if !tst.err {
+					t.Fatal(err)
+				}
+				return
+			} else if tst.err {
+				t.Fatal("was supposed to error")
+			}
+			if got != tst.want {
+				t.Fatalf("got %q, want %q", got, tst.want)
+			}
+		})
+	}
+}
+
+func TestExpandConfig(t *testing.T) {
+	c := &Config{
+		PQ: []*PQConfig{{
+			ID:   "main",
+			Host: "${DBC_TEST_UNSET:?set DBC_TEST_UNSET to the postgres host}",
+			User: "postgres",
+			DB:   "app",
+		}},
+	}
+
+	_, err := NewFromConfig(c)
+	if err == nil {
+		t.Fatal("was supposed to error")
+	}
+	want := `invalid config: pq "main": host: DBC_TEST_UNSET: set DBC_TEST_UNSET to the postgres host`
+	if err.Error() != want {
+		t.Fatalf("got %s, want %s", err.Error(), want)
+	}
+}
@@ -2,7 +2,6 @@ package dbconnect
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/gomodule/redigo/redis"
 	"github.com/jackc/pgx/v4/pgxpool"
@@ -11,42 +10,42 @@ import (
 )
 
 // GetPQ returns a pointer to an pgxpool.Pool instance identified by input
-func (c Conns) GetPQ(id string) (*pgxpool.Pool, error) {
-	if c.pqMap == nil {
-		return nil, fmt.Errorf("possibly no postgresql configurations provided")
-	}
+func (c *Conns) GetPQ(id string) (*pgxpool.Pool, error) {
+	return c.GetPQContext(context.Background(), id)
+}
 
-	if _, ok := c.pqMap[id]; !ok {
-		return nil, fmt.Errorf("no postgreql configuration for ID: %s found", id)
+// GetPQContext is GetPQ bounded by ctx. When the pool isn't connected yet,
+// ctx only limits how long the caller waits: the connect itself carries on
+// for other callers and the next call
+func (c *Conns) GetPQContext(ctx context.Context, id string) (*pgxpool.Pool, error) {
+	pc, err := c.pq(id)
+	if err != nil {
+		return nil, err
 	}
-
-	return c.c.PQ[c.pqMap[id]].db()
+	return pc.db(ctx)
 }
 
 // GetRoach returns a pointer to an pgxpool.Pool instance identified by input
-func (c Conns) GetRoach(id string) (*pgxpool.Pool, error) {
-	if c.roachMap == nil {
-		return nil, fmt.Errorf("possibly no cockroachdb configurations provided")
-	}
+func (c *Conns) GetRoach(id string) (*pgxpool.Pool, error) {
+	return c.GetRoachContext(context.Background(), id)
+}
 
-	if _, ok := c.roachMap[id]; !ok {
-		return nil, fmt.Errorf("no cockroach configuration for ID: %s found", id)
+// GetRoachContext is GetRoach bounded by ctx; see GetPQContext
+func (c *Conns) GetRoachContext(ctx context.Context, id string) (*pgxpool.Pool, error) {
+	rc, err := c.roach(id)
+	if err != nil {
+		return nil, err
 	}
-
-	return c.c.CockroachDB[c.roachMap[id]].db()
+	return rc.db(ctx)
 }
 
 // GetRedisPool returns a pointer to a redis.Pool instance identified by input
-func (c Conns) GetRedisPool(id string) (*redis.Pool, error) {
-	if c.redisMap == nil {
-		return nil, fmt.Errorf("possibly no redis configurations provided")
-	}
-
-	if _, ok := c.redisMap[id]; !ok {
-		return nil, fmt.Errorf("no redis configuration for ID: %s found", id)
+func (c *Conns) GetRedisPool(id string) (*redis.Pool, error) {
+	rc, err := c.redis(id)
+	if err != nil {
+		return nil, err
 	}
-
-	return c.c.Redis[c.redisMap[id]].pool()
+	return rc.pool()
 }
 
 // GetRedisConn is a conveninece function; returns a redis.Conn instance identified by input
@@ -55,18 +54,41 @@ func (c Conns) GetRedisPool(id string) (*redis.Pool, error) {
 //
 //	conn, _ := dbconnect.GetRedisConn("redis_main")
 //	defer conn.Close()
-func (c Conns) GetRedisConn(id string) (redis.Conn, error) {
-	p, err := c.GetRedisPool(id)
+func (c *Conns) GetRedisConn(id string) (redis.Conn, error) {
+	rc, err := c.redis(id)
+	if err != nil {
+		return nil, err
+	}
+	p, err := rc.pool()
+	if err != nil {
+		return nil, err
+	}
+
+	return rc.wrap(p.Get()), nil
+}
+
+// GetRedisConnContext is GetRedisConn bounded by ctx; it waits at most until
+// ctx is done for a connection to be dialed or, when the pool is at its
+// MaxActive limit with Wait set, to be returned to the pool
+func (c *Conns) GetRedisConnContext(ctx context.Context, id string) (redis.Conn, error) {
+	rc, err := c.redis(id)
+	if err != nil {
+		return nil, err
+	}
+	p, err := rc.pool()
 	if err != nil {
 		return nil, err
 	}
 
-	fmt.Printf("\nYou've requested a redis.Conn instance. Don't forget to close it after your work is done\n\n")
-	return p.Get(), nil
+	conn, err := p.GetContext(ctx)
+	if err != nil {
+		return nil, blockError(rc, ErrConnect, err)
+	}
+	return rc.wrap(conn), nil
 }
 
 // GetRedisPubSubConn is a convenience function; returns a redis.PubSubConn instance identified by input
-func (c Conns) GetRedisPubSubConn(id string) (redis.PubSubConn, error) {
+func (c *Conns) GetRedisPubSubConn(id string) (redis.PubSubConn, error) {
 	conn, err := c.GetRedisConn(id)
 	if err != nil {
 		return redis.PubSubConn{}, err
@@ -78,27 +100,105 @@ func (c Conns) GetRedisPubSubConn(id string) (redis.PubSubConn, error) {
 }
 
 // GetMongoClient returns a pointer to a mongo.Client instance identified by input
-func (c Conns) GetMongoClient(ctx context.Context, id string) (*mongo.Client, error) {
-	if c.mongoMap == nil {
-		return nil, fmt.Errorf("possibly no mongo configurations provided")
+func (c *Conns) GetMongoClient(ctx context.Context, id string) (*mongo.Client, error) {
+	mc, err := c.mongo(id)
+	if err != nil {
+		return nil, err
 	}
+	return mc.client(ctx)
+}
 
-	if _, ok := c.mongoMap[id]; !ok {
-		return nil, fmt.Errorf("no mongo configuration for ID: %s found", id)
+// GetMongoDB returns a pointer to a mongo.Database instance identified by input
+func (c *Conns) GetMongoDB(ctx context.Context, id string, opts ...*options.DatabaseOptions) (*mongo.Database, error) {
+	mc, err := c.mongo(id)
+	if err != nil {
+		return nil, err
+	}
+	return mc.db(ctx, opts...)
+}
+
+// pq returns the block configured for id. The lookup is guarded since
+// a reload may swap blocks at any time
+func (c *Conns) pq(id string) (*PQConfig, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return nil, &Error{Backend: "pq", ID: id, Kind: ErrClosed}
+	}
+	if c.draining {
+		return nil, &Error{Backend: "pq", ID: id, Kind: ErrDraining}
+	}
+
+	if c.pqMap == nil {
+		return nil, &Error{Backend: "pq", Kind: ErrNoConfig}
 	}
 
-	return c.c.Mongo[c.mongoMap[id]].client(ctx)
+	if _, ok := c.pqMap[id]; !ok {
+		return nil, &Error{Backend: "pq", ID: id, Kind: ErrUnknownID}
+	}
+
+	return c.c.PQ[c.pqMap[id]], nil
 }
 
-// GetMongoDB returns a pointer to a mongo.Database instance identified by input
-func (c Conns) GetMongoDB(ctx context.Context, id string, opts ...*options.DatabaseOptions) (*mongo.Database, error) {
+func (c *Conns) roach(id string) (*RoachConfig, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return nil, &Error{Backend: "cockroachdb", ID: id, Kind: ErrClosed}
+	}
+	if c.draining {
+		return nil, &Error{Backend: "cockroachdb", ID: id, Kind: ErrDraining}
+	}
+
+	if c.roachMap == nil {
+		return nil, &Error{Backend: "cockroachdb", Kind: ErrNoConfig}
+	}
+
+	if _, ok := c.roachMap[id]; !ok {
+		return nil, &Error{Backend: "cockroachdb", ID: id, Kind: ErrUnknownID}
+	}
+
+	return c.c.CockroachDB[c.roachMap[id]], nil
+}
+
+func (c *Conns) redis(id string) (*RedisConfig, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return nil, &Error{Backend: "redis", ID: id, Kind: ErrClosed}
+	}
+	if c.draining {
+		return nil, &Error{Backend: "redis", ID: id, Kind: ErrDraining}
+	}
+
+	if c.redisMap == nil {
+		return nil, &Error{Backend: "redis", Kind: ErrNoConfig}
+	}
+
+	if _, ok := c.redisMap[id]; !ok {
+		return nil, &Error{Backend: "redis", ID: id, Kind: ErrUnknownID}
+	}
+
+	return c.c.Redis[c.redisMap[id]], nil
+}
+
+func (c *Conns) mongo(id string) (*MongoConfig, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return nil, &Error{Backend: "mongo", ID: id, Kind: ErrClosed}
+	}
+	if c.draining {
+		return nil, &Error{Backend: "mongo", ID: id, Kind: ErrDraining}
+	}
+
 	if c.mongoMap == nil {
-		return nil, fmt.Errorf("possibly no mongo configurations provided")
+		return nil, &Error{Backend: "mongo", Kind: ErrNoConfig}
 	}
 
 	if _, ok := c.mongoMap[id]; !ok {
-		return nil, fmt.Errorf("no mongo configuration for ID: %s found", id)
+		return nil, &Error{Backend: "mongo", ID: id, Kind: ErrUnknownID}
 	}
 
-	return c.c.Mongo[c.mongoMap[id]].db(ctx, opts...)
+	return c.c.Mongo[c.mongoMap[id]], nil
 }
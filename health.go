@@ -0,0 +1,238 @@
+package dbconnect
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HealthStatus is the state of a single block, or of all of them, as
+// reported by Health and HealthHandler
+type HealthStatus string
+
+const (
+	HealthUp HealthStatus = "up"
+	// HealthDegraded is only reported by HealthHandler, when an optional
+	// block is down but every critical one is up
+	HealthDegraded HealthStatus = "degraded"
+	HealthDown     HealthStatus = "down"
+	// HealthIdle is reported by Health for a block that wasn't connected
+	// yet; it isn't pinged
+	HealthIdle HealthStatus = "idle"
+)
+
+// DefaultHealthTimeout bounds every ping of Health and HealthHandler
+// unless a shorter deadline is set
+const DefaultHealthTimeout = 5 * time.Second
+
+// HealthCheck is the outcome of checking a single block
+type HealthCheck struct {
+	Backend string        `json:"backend"`
+	ID      string        `json:"id"`
+	Status  HealthStatus  `json:"status"`
+	Latency time.Duration `json:"-"`
+	// Optional is set by HealthHandler for blocks that don't affect readiness
+	Optional bool  `json:"optional,omitempty"`
+	Err      error `json:"-"`
+}
+
+// MarshalJSON renders Latency in milliseconds and Err as its message
+func (hc HealthCheck) MarshalJSON() ([]byte, error) {
+	type plain HealthCheck
+	out := struct {
+		plain
+		LatencyMS float64 `json:"latency_ms"`
+		Error     string  `json:"error,omitempty"`
+	}{plain: plain(hc), LatencyMS: float64(hc.Latency) / float64(time.Millisecond)}
+	if hc.Err != nil {
+		out.Error = hc.Err.Error()
+	}
+	return json.Marshal(out)
+}
+
+// HealthReport is the outcome of checking every block
+type HealthReport struct {
+	// Status is HealthDown when any checked block is down
+	Status HealthStatus  `json:"status"`
+	Checks []HealthCheck `json:"checks"`
+}
+
+// Health pings every opened pool and client in parallel, each bounded by
+// DefaultHealthTimeout, and reports their status in config order. Blocks
+// that weren't connected yet are reported as HealthIdle and aren't
+// connected by Health
+func (c *Conns) Health(ctx context.Context) (HealthReport, error) {
+	c.mu.RLock()
+	if c.closed {
+		c.mu.RUnlock()
+		return HealthReport{Status: HealthDown}, &Error{Kind: ErrClosed}
+	}
+	var bs []block
+	for _, b := range c.c.blocks() {
+		bs = append(bs, b)
+	}
+	c.mu.RUnlock()
+
+	checks := health(ctx, DefaultHealthTimeout, bs, func(block) bool { return false })
+	report := HealthReport{Status: HealthUp, Checks: checks}
+	for _, hc := range checks {
+		if hc.Status == HealthDown {
+			report.Status = HealthDown
+		}
+	}
+	return report, nil
+}
+
+// health checks bs in parallel. A block that isn't open is connected
+// first when connect returns true for it, otherwise it's reported idle
+func health(ctx context.Context, timeout time.Duration, bs []block, connect func(block) bool) []HealthCheck {
+	checks := make([]HealthCheck, len(bs))
+	var wg sync.WaitGroup
+	for i, b := range bs {
+		wg.Add(1)
+		go func(i int, b block) {
+			defer wg.Done()
+			checks[i] = check(ctx, timeout, b, connect(b))
+		}(i, b)
+	}
+	wg.Wait()
+	return checks
+}
+
+func check(ctx context.Context, timeout time.Duration, b block, connect bool) HealthCheck {
+	hc := HealthCheck{Backend: b.backend(), ID: b.ident(), Status: HealthUp}
+	if !b.opened() && !connect {
+		hc.Status = HealthIdle
+		return hc
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := b.open(ctx)
+	if err == nil {
+		if perr := ping(ctx, b); perr != nil {
+			err = blockError(b, ErrConnect, perr)
+		}
+	}
+	hc.Latency = time.Since(start)
+	if err != nil {
+		hc.Status, hc.Err = HealthDown, err
+	}
+	return hc
+}
+
+// HealthOptions configures HealthHandler
+type HealthOptions struct {
+	// Timeout bounds the check of every block. Default: DefaultHealthTimeout
+	Timeout time.Duration
+	// Critical lists the ids that must be up for /readyz to succeed; they
+	// are connected when they weren't yet, and a critical id that isn't
+	// configured is reported down. When empty, every configured id not
+	// listed in Optional is critical. An id matches the blocks of every
+	// backend configured with it
+	Critical []string
+	// Optional lists the ids that are reported by /readyz but only degrade
+	// it. They are pinged when opened and reported idle otherwise
+	Optional []string
+}
+
+// HealthHandler serves the health of c as json:
+//
+//	/healthz  liveness; 200 until Close is called, nothing is pinged
+//	/readyz   readiness; 503 when any critical block is down
+//
+// Both paths are matched by suffix, so the handler can be mounted under
+// any prefix. Every other path is answered with 404
+func (c *Conns) HealthHandler(opts HealthOptions) http.Handler {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultHealthTimeout
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/healthz"):
+			c.mu.RLock()
+			closed := c.closed
+			c.mu.RUnlock()
+			report := HealthReport{Status: HealthUp}
+			if closed {
+				report.Status = HealthDown
+			}
+			writeHealth(w, report)
+		case strings.HasSuffix(r.URL.Path, "/readyz"):
+			writeHealth(w, c.ready(r.Context(), &opts))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// ready checks the critical and optional blocks of opts
+func (c *Conns) ready(ctx context.Context, opts *HealthOptions) HealthReport {
+	c.mu.RLock()
+	if c.closed {
+		c.mu.RUnlock()
+		return HealthReport{Status: HealthDown}
+	}
+	all := c.c.blocks()
+	c.mu.RUnlock()
+
+	critical, optional := map[string]bool{}, map[string]bool{}
+	for _, id := range opts.Critical {
+		critical[id] = true
+	}
+	for _, id := range opts.Optional {
+		optional[id] = true
+	}
+	isCritical := func(b block) bool {
+		if len(critical) == 0 {
+			return !optional[b.ident()]
+		}
+		return critical[b.ident()]
+	}
+
+	var bs []block
+	for _, b := range all {
+		if isCritical(b) || optional[b.ident()] {
+			bs = append(bs, b)
+		}
+	}
+
+	report := HealthReport{Status: HealthUp, Checks: health(ctx, opts.Timeout, bs, isCritical)}
+	for i, hc := range report.Checks {
+		if !isCritical(bs[i]) {
+			report.Checks[i].Optional = true
+			if hc.Status == HealthDown && report.Status == HealthUp {
+				report.Status = HealthDegraded
+			}
+			continue
+		}
+		if hc.Status == HealthDown {
+			report.Status = HealthDown
+		}
+	}
+	for _, id := range opts.Critical {
+		found := false
+		for _, b := range all {
+			found = found || b.ident() == id
+		}
+		if !found {
+			report.Status = HealthDown
+			report.Checks = append(report.Checks, HealthCheck{ID: id, Status: HealthDown, Err: &Error{ID: id, Kind: ErrUnknownID}})
+		}
+	}
+	return report
+}
+
+func writeHealth(w http.ResponseWriter, report HealthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status == HealthDown {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(report)
+}
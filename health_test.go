@@ -0,0 +1,104 @@
+package dbconnect
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealth(t *testing.T) {
+	conns, err := Build(
+		WithPostgres("main", downPQ(&PQConfig{})),
+		WithRedis("cache", downRedis(&RedisConfig{})),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conns.Close(context.Background())
+
+	report, err := conns.Health(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Status != HealthUp || len(report.Checks) != 2 {
+		t.Fatalf("got %+v, want 2 idle checks", report)
+	}
+	for _, hc := range report.Checks {
+		if hc.Status != HealthIdle {
+			t.Fatalf("%s %s: got %s, want idle", hc.Backend, hc.ID, hc.Status)
+		}
+	}
+
+	// a redis pool is opened without dialing
+	if _, err := conns.GetRedisPool("cache"); err != nil {
+		t.Fatal(err)
+	}
+	report, _ = conns.Health(context.Background())
+	if report.Status != HealthDown || report.Checks[1].Status != HealthDown || report.Checks[1].Err == nil {
+		t.Fatalf("got %+v, want cache down", report)
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	conns, err := Build(
+		WithPostgres("main", downPQ(&PQConfig{})),
+		WithRedis("cache", downRedis(&RedisConfig{})),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conns.GetRedisPool("cache"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		opts   HealthOptions
+		code   int
+		status HealthStatus
+		checks int
+	}{
+		{"liveness", "/healthz", HealthOptions{}, http.StatusOK, HealthUp, 0},
+		{"critical down", "/readyz", HealthOptions{Optional: []string{"cache"}}, http.StatusServiceUnavailable, HealthDown, 2},
+		{"optional down", "/readyz", HealthOptions{Critical: []string{}, Optional: []string{"cache", "main"}}, http.StatusOK, HealthDegraded, 2},
+		{"unknown critical", "/readyz", HealthOptions{Critical: []string{"reports"}}, http.StatusServiceUnavailable, HealthDown, 1},
+		{"prefix", "/internal/readyz", HealthOptions{Critical: []string{"cache"}}, http.StatusServiceUnavailable, HealthDown, 1},
+		{"not found", "/metrics", HealthOptions{}, http.StatusNotFound, "", 0},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			conns.HealthHandler(tst.opts).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tst.path, nil))
+			if rec.Code != tst.code {
+				t.Fatalf("got status code %d, want %d", rec.Code, tst.code)
+			}
+			if tst.code == http.StatusNotFound {
+				return
+			}
+
+			var report struct {
+				Status HealthStatus      `json:"status"`
+				Checks []json.RawMessage `json:"checks"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+				t.Fatal(err)
+			}
+			if report.Status != tst.status || len(report.Checks) != tst.checks {
+				t.Fatalf("got %s with %d checks, want %s with %d", report.Status, len(report.Checks), tst.status, tst.checks)
+			}
+		})
+	}
+
+	if err := conns.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	conns.HealthHandler(HealthOptions{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got status code %d after Close, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
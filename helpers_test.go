@@ -0,0 +1,82 @@
+package dbconnect
+
+import (
+	"net"
+	"sync"
+	"testing"
+)
+
+// listen accepts tcp connections and answers +OK to everything read;
+// enough for a redis pool that doesn't authenticate or select a database
+func listen(t *testing.T) *net.TCPAddr {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		mu     sync.Mutex
+		conns  []net.Conn
+		closed bool
+	)
+	t.Cleanup(func() {
+		l.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		closed = true
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			if closed {
+				mu.Unlock()
+				conn.Close()
+				return
+			}
+			conns = append(conns, conn)
+			mu.Unlock()
+			go func() {
+				buf := make([]byte, 512)
+				for {
+					if _, err := conn.Read(buf); err != nil {
+						return
+					}
+					if _, err := conn.Write([]byte("+OK\r\n")); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return l.Addr().(*net.TCPAddr)
+}
+
+// silent accepts tcp connections but never answers, so connects and reads
+// hang until they time out
+func silent(t *testing.T) *net.TCPAddr {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l.Addr().(*net.TCPAddr)
+}
+
+// downPQ points pc at port 1 of the loopback address. Nothing listens
+// there, so every connect or ping fails right away
+func downPQ(pc *PQConfig) *PQConfig {
+	pc.Host, pc.Port, pc.User, pc.DB, pc.ConnectTimeout = "127.0.0.1", 1, "app", "app", 1
+	return pc
+}
+
+// downRedis points rc at port 1 of the loopback address; see downPQ
+func downRedis(rc *RedisConfig) *RedisConfig {
+	rc.Host, rc.Port = "127.0.0.1", 1
+	return rc
+}
@@ -0,0 +1,73 @@
+package dbconnect
+
+import "time"
+
+// Logger receives the lifecycle events of a Conns instance: config loaded
+// and reloaded, connecting, connected, connect failed and closed. args are
+// alternating keys and values, e.g. "backend", "pq", "id", "main".
+// A *slog.Logger satisfies Logger
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// WithLogger routes the lifecycle events to l. dbconnect is silent by default
+func WithLogger(l Logger) Option {
+	return func(s *settings) {
+		s.logger = l
+	}
+}
+
+// nopLogger discards everything
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+// orNop returns l, or a logger discarding everything when l is nil
+func orNop(l Logger) Logger {
+	if l == nil {
+		return nopLogger{}
+	}
+	return l
+}
+
+// log returns the logger of c; never nil
+func (c *Conns) log() Logger {
+	if c.s == nil {
+		return nopLogger{}
+	}
+	return orNop(c.s.logger)
+}
+
+// logConnect wraps the connect fn of b with lifecycle logging
+func logConnect(l Logger, b describable, fn func() error) func() error {
+	l = orNop(l)
+	return func() error {
+		l.Info("connecting", "backend", b.backend(), "id", b.ident(), "addr", b.preview())
+		start := time.Now()
+		if err := fn(); err != nil {
+			l.Error("connect failed", "backend", b.backend(), "id", b.ident(), "err", err)
+			return err
+		}
+		l.Info("connected", "backend", b.backend(), "id", b.ident(), "duration", time.Since(start))
+		return nil
+	}
+}
+
+// logClose wraps the close fn of b with lifecycle logging
+func logClose(l Logger, b block, fn func() error) func() error {
+	l = orNop(l)
+	return func() error {
+		if err := fn(); err != nil {
+			l.Error("close failed", "backend", b.backend(), "id", b.ident(), "err", err)
+			return err
+		}
+		l.Info("closed", "backend", b.backend(), "id", b.ident())
+		return nil
+	}
+}
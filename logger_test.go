@@ -0,0 +1,81 @@
+package dbconnect
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordLogger keeps every message with its args rendered as key=value
+type recordLogger struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (rl *recordLogger) log(level, msg string, args []interface{}) {
+	line := level + " " + msg
+	for i := 0; i+1 < len(args); i += 2 {
+		line += fmt.Sprintf(" %v=%v", args[i], args[i+1])
+	}
+	rl.mu.Lock()
+	rl.msgs = append(rl.msgs, line)
+	rl.mu.Unlock()
+}
+
+func (rl *recordLogger) Debug(msg string, args ...interface{}) { rl.log("DEBUG", msg, args) }
+func (rl *recordLogger) Info(msg string, args ...interface{})  { rl.log("INFO", msg, args) }
+func (rl *recordLogger) Warn(msg string, args ...interface{})  { rl.log("WARN", msg, args) }
+func (rl *recordLogger) Error(msg string, args ...interface{}) { rl.log("ERROR", msg, args) }
+
+func (rl *recordLogger) find(prefix string) string {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	for _, m := range rl.msgs {
+		if strings.HasPrefix(m, prefix) {
+			return m
+		}
+	}
+	return ""
+}
+
+func TestLogger(t *testing.T) {
+	addr := listen(t)
+	rl := &recordLogger{}
+	conns, err := Build(
+		WithLogger(rl),
+		WithRedis("cache", &RedisConfig{Host: "127.0.0.1", Port: addr.Port}),
+		WithPostgres("down", downPQ(&PQConfig{})),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conns.GetRedisPool("cache"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conns.GetPQ("down"); err == nil {
+		t.Fatal("expected a connect error")
+	}
+	if err := conns.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"INFO config loaded profile= pq=1 cockroachdb=0 redis=1 mongo=0",
+		"INFO connecting backend=redis id=cache",
+		"INFO connected backend=redis id=cache",
+		"ERROR connect failed backend=pq id=down",
+		"INFO closed backend=redis id=cache",
+	} {
+		if rl.find(want) == "" {
+			t.Errorf("no %q in %q", want, rl.msgs)
+		}
+	}
+}
+
+func TestLoggerSilent(t *testing.T) {
+	var c Conns
+	c.log().Info("dropped")
+	logConnect(nil, &RedisConfig{ID: "cache"}, func() error { return nil })()
+}
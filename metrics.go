@@ -0,0 +1,143 @@
+package dbconnect
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// poolStats is the pool of a single block, normalized across drivers.
+// Counters a driver doesn't keep stay zero
+type poolStats struct {
+	open  int64
+	inUse int64
+	idle  int64
+	// max is the configured size limit; 0 when unlimited
+	max int64
+	// acquires counts every connection handed out of the pool
+	acquires int64
+	// waits counts the acquires that had to wait for a connection
+	waits int64
+	// wait is the time spent acquiring connections
+	wait time.Duration
+	// failures counts the acquires that failed or were canceled
+	failures int64
+}
+
+func pgxStats(st *pgxpool.Stat) poolStats {
+	return poolStats{
+		open:     int64(st.TotalConns()),
+		inUse:    int64(st.AcquiredConns()),
+		idle:     int64(st.IdleConns()),
+		max:      int64(st.MaxConns()),
+		acquires: st.AcquireCount(),
+		waits:    st.EmptyAcquireCount(),
+		wait:     st.AcquireDuration(),
+		failures: st.CanceledAcquireCount(),
+	}
+}
+
+// MetricType is the kind of a Metric, named after the Prometheus types
+type MetricType string
+
+const (
+	MetricGauge   MetricType = "gauge"
+	MetricCounter MetricType = "counter"
+)
+
+// Metric is a single sample of the pool of a block
+type Metric struct {
+	Name    string     `json:"name"`
+	Help    string     `json:"help"`
+	Type    MetricType `json:"type"`
+	Backend string     `json:"backend"`
+	ID      string     `json:"id"`
+	Value   float64    `json:"value"`
+}
+
+// metricDesc describes a metric derived from poolStats
+type metricDesc struct {
+	name  string
+	help  string
+	typ   MetricType
+	value func(poolStats) float64
+}
+
+var metricDescs = []metricDesc{
+	{"dbconnect_connections_open", "Connections currently open, idle or in use", MetricGauge, func(st poolStats) float64 { return float64(st.open) }},
+	{"dbconnect_connections_in_use", "Connections currently acquired from the pool", MetricGauge, func(st poolStats) float64 { return float64(st.inUse) }},
+	{"dbconnect_connections_idle", "Connections currently idle in the pool", MetricGauge, func(st poolStats) float64 { return float64(st.idle) }},
+	{"dbconnect_connections_max", "Configured maximum size of the pool; 0 when unlimited", MetricGauge, func(st poolStats) float64 { return float64(st.max) }},
+	{"dbconnect_acquires_total", "Connections acquired from the pool", MetricCounter, func(st poolStats) float64 { return float64(st.acquires) }},
+	{"dbconnect_acquire_waits_total", "Acquires that had to wait for a connection", MetricCounter, func(st poolStats) float64 { return float64(st.waits) }},
+	{"dbconnect_acquire_wait_seconds_total", "Time spent acquiring connections", MetricCounter, func(st poolStats) float64 { return st.wait.Seconds() }},
+	{"dbconnect_acquire_failures_total", "Acquires that failed or were canceled", MetricCounter, func(st poolStats) float64 { return float64(st.failures) }},
+}
+
+// Metrics returns the pool metrics of every opened block, grouped by
+// metric name. A block is included as soon as it is opened, so nothing
+// needs to be registered per connection. Counters a driver doesn't keep
+// are reported as 0: redis has no acquire or failure counts and mongo
+// has no wait counts
+func (c *Conns) Metrics() []Metric {
+	c.mu.RLock()
+	all := c.c.blocks()
+	c.mu.RUnlock()
+
+	var bs []block
+	var sts []poolStats
+	for _, b := range all {
+		if b.opened() {
+			bs = append(bs, b)
+			sts = append(sts, b.stats())
+		}
+	}
+
+	var ms []Metric
+	for _, d := range metricDescs {
+		for i, b := range bs {
+			ms = append(ms, Metric{
+				Name:    d.name,
+				Help:    d.help,
+				Type:    d.typ,
+				Backend: b.backend(),
+				ID:      b.ident(),
+				Value:   d.value(sts[i]),
+			})
+		}
+	}
+	return ms
+}
+
+// WriteMetrics writes Metrics to w in the Prometheus text exposition format
+func (c *Conns) WriteMetrics(w io.Writer) error {
+	last := ""
+	for _, m := range c.Metrics() {
+		if m.Name != last {
+			if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.Name, m.Help, m.Name, m.Type); err != nil {
+				return err
+			}
+			last = m.Name
+		}
+		if _, err := fmt.Fprintf(w, "%s{backend=\"%s\",id=\"%s\"} %g\n", m.Name, m.Backend, labelEscaper.Replace(m.ID), m.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// labelEscaper escapes label values as the text exposition format expects
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// MetricsHandler serves WriteMetrics, e.g. to be scraped by Prometheus
+// at /metrics
+func (c *Conns) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = c.WriteMetrics(w)
+	})
+}
@@ -0,0 +1,74 @@
+package dbconnect
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/event"
+)
+
+func TestMetrics(t *testing.T) {
+	addr := listen(t)
+	conns, err := Build(
+		WithRedis("cache", &RedisConfig{Host: "127.0.0.1", Port: addr.Port, MaxActive: 8}),
+		WithRedis("lazy", &RedisConfig{Host: "127.0.0.1", Port: addr.Port}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conns.Close(context.Background())
+
+	conn, err := conns.GetRedisConnContext(context.Background(), "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	got := map[string]float64{}
+	for _, m := range conns.Metrics() {
+		if m.ID != "cache" {
+			t.Fatalf("got a metric for %s, which was never opened", m.ID)
+		}
+		got[m.Name] = m.Value
+	}
+	if len(got) != len(metricDescs) {
+		t.Fatalf("got %d metrics, want %d", len(got), len(metricDescs))
+	}
+	if got["dbconnect_connections_in_use"] != 1 || got["dbconnect_connections_max"] != 8 {
+		t.Fatalf("got %v, want 1 connection in use of 8", got)
+	}
+
+	var buf bytes.Buffer
+	if err := conns.WriteMetrics(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"# TYPE dbconnect_connections_in_use gauge",
+		`dbconnect_connections_in_use{backend="redis",id="cache"} 1`,
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Fatalf("missing %q in\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestMongoPoolMonitor(t *testing.T) {
+	var mc MongoConfig
+	mc.reset()
+	pm := mc.pool.monitor()
+	for _, typ := range []string{
+		event.ConnectionCreated, event.ConnectionCreated,
+		event.GetStarted, event.GetSucceeded,
+		event.GetStarted, event.GetSucceeded, event.ConnectionReturned,
+		event.GetStarted, event.GetFailed,
+	} {
+		pm.Event(&event.PoolEvent{Type: typ})
+	}
+
+	st := mc.stats()
+	if st.open != 2 || st.inUse != 1 || st.idle != 1 || st.acquires != 3 || st.failures != 1 {
+		t.Fatalf("got %+v", st)
+	}
+}
@@ -3,40 +3,86 @@ package dbconnect
 import (
 	"context"
 	"fmt"
-	"log"
-	"os"
-	"sync"
+	"sync/atomic"
+	"time"
 
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // MongoConfig defines all the parameters to be used for establishing
 // a mongodb connection
 type MongoConfig struct {
-	ID               string `json:"id,omitempty" toml:"id,omitempty"`
-	DB               string `json:"db,omitempty" toml:"db,omitempty"`
-	User             string `json:"user,omitempty" toml:"user,omitempty"`
-	Pwd              string `json:"pwd,omitempty" toml:"pwd,omitempty"`
-	AuthSource       string `json:"authSource,omitempty" toml:"authSource,omitempty"`
-	Host             string `json:"host,omitempty" toml:"host,omitempty"`
-	Port             int    `json:"port,omitempty" toml:"port,omitempty"`
-	ConnectionString string `json:"connectionString,omitempty" toml:"connectionString,omitempty"`
-	_client          *mongo.Client
-	once             sync.Once
+	ID                     string `json:"id,omitempty" toml:"id,omitempty"`
+	DB                     string `json:"db,omitempty" toml:"db,omitempty"`
+	User                   string `json:"user,omitempty" toml:"user,omitempty"`
+	Pwd                    string `json:"pwd,omitempty" toml:"pwd,omitempty"`
+	AuthSource             string `json:"authSource,omitempty" toml:"authSource,omitempty"`
+	Host                   string `json:"host,omitempty" toml:"host,omitempty"`
+	Port                   int    `json:"port,omitempty" toml:"port,omitempty"`
+	ConnectionString       string `json:"connectionString,omitempty" toml:"connectionString,omitempty"`
+	Eager                  bool   `json:"eager,omitempty" toml:"eager,omitempty"`                                       // connect when the config is loaded rather than on first use
+	BreakerFailures        int    `json:"breaker_failures,omitempty" toml:"breaker_failures,omitempty"`                 // consecutive failures that open the circuit breaker; 0 disables it
+	BreakerCooldownSeconds int    `json:"breaker_cooldown_seconds,omitempty" toml:"breaker_cooldown_seconds,omitempty"` // how long the breaker stays open before a trial. Default: 30
+	SlowQueryMs            int    `json:"slow_query_ms,omitempty" toml:"slow_query_ms,omitempty"`                       // log commands slower than this through the Logger, in ms; 0 disables it
+	h                      *handle[*mongo.Client]
+	secrets                *secrets
+	breaker                *breaker
+	tracer                 trace.Tracer
+	logger                 Logger
+	pool                   *mongoPool
 }
 
-func (mc *MongoConfig) expandEnv() {
-	mc.ID = os.ExpandEnv(mc.ID)
-	mc.DB = os.ExpandEnv(mc.DB)
-	mc.User = os.ExpandEnv(mc.User)
-	mc.Pwd = os.ExpandEnv(mc.Pwd)
-	mc.AuthSource = os.ExpandEnv(mc.AuthSource)
-	mc.Host = os.ExpandEnv(mc.Host)
-	mc.ConnectionString = os.ExpandEnv(mc.ConnectionString)
+// mongoPool counts the connection pool events of a client; the driver
+// doesn't expose pool statistics otherwise
+type mongoPool struct {
+	max        int64
+	open       atomic.Int64
+	checkedOut atomic.Int64
+	checkouts  atomic.Int64
+	failed     atomic.Int64
+}
+
+func (mp *mongoPool) monitor() *event.PoolMonitor {
+	return &event.PoolMonitor{
+		Event: func(e *event.PoolEvent) {
+			switch e.Type {
+			case event.ConnectionCreated:
+				mp.open.Add(1)
+			case event.ConnectionClosed:
+				mp.open.Add(-1)
+			case event.GetStarted:
+				mp.checkouts.Add(1)
+			case event.GetFailed:
+				mp.failed.Add(1)
+			case event.GetSucceeded:
+				mp.checkedOut.Add(1)
+			case event.ConnectionReturned:
+				mp.checkedOut.Add(-1)
+			}
+		},
+	}
+}
+
+func (mc *MongoConfig) expandEnv() []error {
+	var e expander
+	e.expand("id", &mc.ID)
+	e.expand("db", &mc.DB)
+	e.expand("user", &mc.User)
+	e.expand("pwd", &mc.Pwd)
+	e.expand("authSource", &mc.AuthSource)
+	e.expand("host", &mc.Host)
+	e.expand("connectionString", &mc.ConnectionString)
+	return e.errs
 }
 
 func (mc *MongoConfig) defaults() {
+	if mc.ConnectionString != "" {
+		return
+	}
+
 	if mc.Host == "" {
 		mc.Host = "localhost"
 	}
@@ -46,15 +92,24 @@ func (mc *MongoConfig) defaults() {
 	}
 }
 
-func (mc *MongoConfig) prepareURI() {
-	mc.expandEnv()
+// uri returns ConnectionString when set, otherwise builds one from
+// the individual settings. Secret references are resolved
+func (mc *MongoConfig) uri(ctx context.Context, sec *secrets) (string, error) {
 	if mc.ConnectionString != "" {
-		return
+		cs, err := sec.resolve(ctx, mc.ConnectionString)
+		if err != nil {
+			return "", fmt.Errorf("connectionString: %s", err.Error())
+		}
+		return cs, nil
 	}
 	mc.defaults()
 	uri := fmt.Sprintf("%s:%d/", mc.Host, mc.Port)
 	if mc.User != "" || mc.Pwd != "" {
-		uri = fmt.Sprintf("%s:%s@%s", mc.User, mc.Pwd, uri)
+		pwd, err := sec.resolve(ctx, mc.Pwd)
+		if err != nil {
+			return "", fmt.Errorf("pwd: %s", err.Error())
+		}
+		uri = fmt.Sprintf("%s:%s@%s", mc.User, pwd, uri)
 	}
 	if mc.DB != "" {
 		uri = fmt.Sprintf("%s%s", uri, mc.DB)
@@ -64,45 +119,73 @@ func (mc *MongoConfig) prepareURI() {
 		uri = fmt.Sprintf("%s?authSource=%s", uri, mc.AuthSource)
 	}
 
-	mc.ConnectionString = fmt.Sprintf("mongodb://%s", uri)
-	log.Printf("ConnectionString: %s\n", mc.ConnectionString)
+	return fmt.Sprintf("mongodb://%s", uri), nil
 }
 
-func (mc *MongoConfig) connect(ctx context.Context) {
-	mc.once.Do(func() {
-		if mc._client != nil {
-			return
+// connect creates the client, waiting at most until ctx is done. The
+// connect itself isn't bound to ctx since other callers may share it
+func (mc *MongoConfig) connect(ctx context.Context) error {
+	return mc.h.connectContext(ctx, logConnect(mc.logger, mc, func() error {
+		ctx := context.Background()
+		uri, err := mc.uri(ctx, mc.secrets)
+		if err != nil {
+			return blockError(mc, ErrInvalidConfig, err)
+		}
+		opts := options.Client().ApplyURI(uri)
+		opts.SetPoolMonitor(mc.pool.monitor())
+		var traced *event.CommandMonitor
+		if mc.tracer != nil {
+			mt := &mongoTracer{tracer: mc.tracer, b: mc}
+			traced = mt.monitor()
+		}
+		var slow *event.CommandMonitor
+		if sl := newSlowLog(mc.logger, mc, mc.SlowQueryMs); sl != nil {
+			slow = sl.monitor()
+		}
+		if m := chainMonitors(traced, slow); m != nil {
+			opts.SetMonitor(m)
+		}
+		mc.pool.max = 100 // the driver's default
+		if opts.MaxPoolSize != nil {
+			mc.pool.max = int64(*opts.MaxPoolSize)
+		}
+		if br := mc.breaker; br != nil {
+			// the driver dials on its own; its heartbeats tell whether the server is reachable
+			opts.SetServerMonitor(&event.ServerMonitor{
+				ServerHeartbeatSucceeded: func(*event.ServerHeartbeatSucceededEvent) { br.record(nil) },
+				ServerHeartbeatFailed:    func(e *event.ServerHeartbeatFailedEvent) { br.record(e.Failure) },
+			})
 		}
-		mc.prepareURI()
-		opts := options.Client().ApplyURI(mc.ConnectionString)
 		client, err := mongo.Connect(ctx, opts)
 		if err != nil {
-			log.Printf("error creating client: %s\n", err.Error())
-			log.Fatal(err.Error())
+			return blockError(mc, ErrConnect, err)
 		}
 
 		if err := client.Ping(ctx, nil); err != nil {
-			log.Printf("error pinging with client: %s", err.Error())
-			log.Fatal(err.Error())
+			_ = client.Disconnect(ctx)
+			return blockError(mc, ErrConnect, err)
 		}
 
-		mc._client = client
-	})
+		mc.h.conn = client
+		return nil
+	}))
 }
 
 // Client returns a *mongo.Client connection
 func (mc *MongoConfig) client(ctx context.Context) (*mongo.Client, error) {
-	mc.connect(ctx)
-	if mc._client == nil {
-		return nil, fmt.Errorf("invalid mongo configuration. client was not created")
+	if err := mc.breaker.guard(ctx, mc, mc.connect); err != nil {
+		return nil, err
 	}
-	return mc._client, nil
+	if err := mc.connect(ctx); err != nil {
+		return nil, blockError(mc, ErrConnect, err)
+	}
+	return mc.h.conn, nil
 }
 
 // Database returns a *mongo.Database object if db key was specified during configuration
 func (mc *MongoConfig) db(ctx context.Context, opts ...*options.DatabaseOptions) (*mongo.Database, error) {
 	if mc.DB == "" {
-		return nil, fmt.Errorf("empty database name")
+		return nil, blockError(mc, ErrInvalidConfig, fmt.Errorf("empty database name"))
 	}
 	c, err := mc.client(ctx)
 	if err != nil {
@@ -110,3 +193,44 @@ func (mc *MongoConfig) db(ctx context.Context, opts ...*options.DatabaseOptions)
 	}
 	return c.Database(mc.DB, opts...), nil
 }
+
+// reset gives mc a new handle and pool counters
+func (mc *MongoConfig) reset() { mc.h, mc.pool = &handle[*mongo.Client]{}, &mongoPool{} }
+
+func (mc *MongoConfig) backend() string { return "mongo" }
+func (mc *MongoConfig) ident() string   { return mc.ID }
+func (mc *MongoConfig) opened() bool    { return mc.h.isConnected() }
+
+func (mc *MongoConfig) open(ctx context.Context) error {
+	_, err := mc.client(ctx)
+	return err
+}
+
+// ping round trips to the server; the block must be open
+func (mc *MongoConfig) ping(ctx context.Context) error {
+	return mc.h.conn.Ping(ctx, nil)
+}
+
+func (mc *MongoConfig) inUse() int { return int(mc.pool.checkedOut.Load()) }
+
+func (mc *MongoConfig) stats() poolStats {
+	open, inUse := mc.pool.open.Load(), mc.pool.checkedOut.Load()
+	return poolStats{
+		open:     open,
+		inUse:    inUse,
+		idle:     open - inUse,
+		max:      mc.pool.max,
+		acquires: mc.pool.checkouts.Load(),
+		failures: mc.pool.failed.Load(),
+	}
+}
+
+func (mc *MongoConfig) isEager() bool     { return mc.Eager }
+func (mc *MongoConfig) since() time.Time  { return mc.h.since() }
+func (mc *MongoConfig) circuit() *breaker { return mc.breaker }
+
+func (mc *MongoConfig) close(ctx context.Context) error {
+	return mc.h.close(ctx, logClose(mc.logger, mc, func() error {
+		return mc.h.conn.Disconnect(ctx)
+	}))
+}
@@ -0,0 +1,154 @@
+package dbconnect
+
+import (
+	"context"
+	"time"
+)
+
+// StateChangeFunc is called by Monitor when the state of a block changes.
+// The first state of a block is reported as a change from HealthIdle.
+// err is the failed ping that caused the change, nil when the block is up
+type StateChangeFunc func(backend, id string, old, new HealthStatus, err error)
+
+// OnStateChange registers fn to be called on every state change reported
+// by Monitor. Hooks are called in the order they were registered, from the
+// goroutine monitoring the block, so they should return quickly
+func (c *Conns) OnStateChange(fn StateChangeFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hooks = append(c.hooks, fn)
+}
+
+// MonitorOptions configures Conns.Monitor
+type MonitorOptions struct {
+	// Interval between pings of every block. Default: 10s
+	Interval time.Duration
+	// Timeout bounds every ping. Default: DefaultHealthTimeout
+	Timeout time.Duration
+	// DownAfter is the number of consecutive failed pings after which a
+	// block is down; fewer failures only degrade it. Default: 3
+	DownAfter int
+}
+
+func (mo *MonitorOptions) defaults() {
+	if mo.Interval <= 0 {
+		mo.Interval = 10 * time.Second
+	}
+
+	if mo.Timeout <= 0 {
+		mo.Timeout = DefaultHealthTimeout
+	}
+
+	if mo.DownAfter <= 0 {
+		mo.DownAfter = 3
+	}
+}
+
+// Monitor starts pinging every opened pool and client in the background
+// and tracks whether it is up, degraded or down; changes are reported to
+// the hooks registered with OnStateChange. Blocks opened later, e.g. by
+// the first getter call, are picked up within an Interval. A block is no
+// longer monitored once it is closed or replaced by a reload.
+// Monitor stops when ctx is done or Close is called
+func (c *Conns) Monitor(ctx context.Context, opts MonitorOptions) error {
+	c.mu.RLock()
+	closed := c.closed
+	c.mu.RUnlock()
+	if closed {
+		return &Error{Kind: ErrClosed}
+	}
+	opts.defaults()
+
+	go func() {
+		t := time.NewTicker(opts.Interval)
+		defer t.Stop()
+		watched := map[block]bool{}
+		for {
+			c.mu.RLock()
+			all := c.c.blocks()
+			c.mu.RUnlock()
+			for _, b := range all {
+				if !watched[b] && b.opened() {
+					watched[b] = true
+					go c.monitor(ctx, b, &opts)
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-c.done:
+				return
+			case <-t.C:
+			}
+		}
+	}()
+	return nil
+}
+
+// monitor pings b every opts.Interval until b is closed or replaced
+func (c *Conns) monitor(ctx context.Context, b block, opts *MonitorOptions) {
+	t := time.NewTicker(opts.Interval)
+	defer t.Stop()
+	state, fails := HealthIdle, 0
+	for {
+		pctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+		err := ping(pctx, b)
+		cancel()
+		if !b.opened() || !c.live(b) {
+			// closed or replaced by a reload while pinging; the failure
+			// isn't the server's
+			return
+		}
+
+		next := HealthUp
+		if err != nil {
+			err = blockError(b, ErrConnect, err)
+			fails++
+			next = HealthDegraded
+			if fails >= opts.DownAfter {
+				next = HealthDown
+			}
+		} else {
+			fails = 0
+		}
+		if next != state {
+			c.stateChanged(b, state, next, err)
+			state = next
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.done:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// live reports whether b is still part of the config of c
+func (c *Conns) live(b block) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, cur := range c.c.blocks() {
+		if cur == b {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Conns) stateChanged(b block, old, new HealthStatus, err error) {
+	c.mu.RLock()
+	hooks := c.hooks
+	c.mu.RUnlock()
+	if new == HealthDown {
+		c.log().Warn("state changed", "backend", b.backend(), "id", b.ident(), "old", string(old), "new", string(new), "err", err)
+	} else {
+		c.log().Info("state changed", "backend", b.backend(), "id", b.ident(), "old", string(old), "new", string(new))
+	}
+	for _, fn := range hooks {
+		fn(b.backend(), b.ident(), old, new, err)
+	}
+}
@@ -0,0 +1,110 @@
+package dbconnect
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMonitor(t *testing.T) {
+	conns, err := Build(WithRedis("cache", downRedis(&RedisConfig{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var changes []HealthStatus
+	conns.OnStateChange(func(backend, id string, old, new HealthStatus, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if backend != "redis" || id != "cache" {
+			t.Errorf("got state change for %s %s", backend, id)
+		}
+		if !errors.Is(err, ErrConnect) {
+			t.Errorf("got %v, want ErrConnect", err)
+		}
+		changes = append(changes, old, new)
+	})
+
+	if err := conns.Monitor(context.Background(), MonitorOptions{Interval: 5 * time.Millisecond, DownAfter: 2}); err != nil {
+		t.Fatal(err)
+	}
+	// the pool is only monitored once it is opened
+	if _, err := conns.GetRedisPool("cache"); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		n := len(changes)
+		mu.Unlock()
+		if n >= 4 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := conns.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	want := []HealthStatus{HealthIdle, HealthDegraded, HealthDegraded, HealthDown}
+	if len(changes) != len(want) {
+		t.Fatalf("got %v, want %v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Fatalf("got %v, want %v", changes, want)
+		}
+	}
+
+	if err := conns.Monitor(context.Background(), MonitorOptions{}); !errors.Is(err, ErrClosed) {
+		t.Fatalf("got %v, want ErrClosed", err)
+	}
+}
+
+func TestMonitorReplaced(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "db.toml")
+	if err := os.WriteFile(p, []byte("[[redis]]\nid=\"cache\"\nhost=\"127.0.0.1\"\nport=1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	conns, err := New(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conns.Close(context.Background())
+	if _, err := conns.GetRedisPool("cache"); err != nil {
+		t.Fatal(err)
+	}
+	old, _ := conns.redis("cache")
+
+	if err := os.WriteFile(p, []byte("[[redis]]\nid=\"cache\"\nhost=\"127.0.0.1\"\nport=2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	conns.reload(context.Background(), &WatchOptions{Grace: time.Hour})
+	if !old.opened() {
+		t.Fatal("replaced pool was closed before the grace period")
+	}
+
+	var calls int
+	conns.OnStateChange(func(string, string, HealthStatus, HealthStatus, error) { calls++ })
+	done := make(chan struct{})
+	go func() {
+		conns.monitor(context.Background(), old, &MonitorOptions{Interval: time.Millisecond, Timeout: time.Second, DownAfter: 1})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("replaced block is still monitored")
+	}
+	if calls != 0 {
+		t.Fatalf("got %d state changes for a replaced block", calls)
+	}
+}
@@ -0,0 +1,70 @@
+package dbconnect
+
+import (
+	"os"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ProfileEnv is the environment variable used to select a profile when
+// WithProfile is not given
+const ProfileEnv = "DBCONNECT_PROFILE"
+
+// profilesKey is the top level config key holding named profiles
+const profilesKey = "profiles"
+
+// Option configures how a Conns instance is built
+type Option func(*settings)
+
+type settings struct {
+	overlays     []string
+	profile      string
+	profileFound bool
+	secrets      *secrets
+	// credentials holds the providers set with WithCredentialProvider by id
+	credentials map[string]CredentialProvider
+	// tracer is set by WithTracerProvider; nil when tracing is off
+	tracer trace.Tracer
+	// logger is set by WithLogger; nil keeps dbconnect silent
+	logger Logger
+	// extra holds blocks added through WithPostgres and friends
+	extra Config
+}
+
+func newSettings(opts []Option) *settings {
+	s := &settings{
+		profile: os.Getenv(ProfileEnv),
+		secrets: newSecrets(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// WithOverlays merges the config files at paths, in order, on top of the
+// base config. Blocks are matched by id, so an overlay only needs to carry
+// the keys it changes, e.g.
+//
+//	[[pq]]
+//	id="main"
+//	host="prod-db.internal"
+func WithOverlays(paths ...string) Option {
+	return func(s *settings) {
+		s.overlays = append(s.overlays, paths...)
+	}
+}
+
+// WithProfile selects the named profile of every config source. A profile
+// is merged on top of the blocks of the file that defines it:
+//
+//	[[profiles.prod.pq]]
+//	id="main"
+//	host="prod-db.internal"
+//
+// Overrides $DBCONNECT_PROFILE
+func WithProfile(name string) Option {
+	return func(s *settings) {
+		s.profile = name
+	}
+}
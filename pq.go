@@ -4,31 +4,39 @@ import (
 	// "database/sql"
 	"context"
 	"fmt"
-	"os"
-	"sync"
+	"time"
 
 	// pq is imported to allow sql connection using driver 'postgres'
 	// _ "github.com/lib/pq"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // PQConfig defines all the parameters to be used for establishing
 // a postgresql connection
 type PQConfig struct {
-	ID              string `json:"id,omitempty" toml:"id,omitempty"`
-	Host            string `json:"host,omitempty" toml:"host,omitempty"`
-	Port            int    `json:"port,omitempty" toml:"port,omitempty"`
-	User            string `json:"user,omitempty" toml:"user,omitempty"`
-	Pwd             string `json:"pwd,omitempty" toml:"pwd,omitempty"`
-	DB              string `json:"db,omitempty" toml:"db,omitempty"`
-	SSLMode         string `json:"sslmode,omitempty" toml:"sslmode,omitempty"` // disable | require | verify-ca | verify-full
-	FallbackAppName string `json:"fallback_application_name,omitempty" toml:"fallback_application_name,omitempty"`
-	ConnectTimeout  int    `json:"connect_timeout,omitempty" toml:"connect_timeout,omitempty"` // in seconds
-	SSLCert         string `json:"sslcert,omitempty" toml:"sslcert,omitempty"`                 // location if PEM encoded cert file
-	SSLKey          string `json:"sslkey,omitempty" toml:"sslkey,omitempty"`                   // location of PEM encoded key file
-	SSLRootCert     string `json:"sslrootcert,omitempty" toml:"sslrootcert,omitempty"`         // location of PEM encoded root certificate file
-	_db             *pgxpool.Pool
-	once            sync.Once
+	ID                     string `json:"id,omitempty" toml:"id,omitempty"`
+	Host                   string `json:"host,omitempty" toml:"host,omitempty"`
+	Port                   int    `json:"port,omitempty" toml:"port,omitempty"`
+	User                   string `json:"user,omitempty" toml:"user,omitempty"`
+	Pwd                    string `json:"pwd,omitempty" toml:"pwd,omitempty"`
+	DB                     string `json:"db,omitempty" toml:"db,omitempty"`
+	SSLMode                string `json:"sslmode,omitempty" toml:"sslmode,omitempty"` // disable | require | verify-ca | verify-full
+	FallbackAppName        string `json:"fallback_application_name,omitempty" toml:"fallback_application_name,omitempty"`
+	ConnectTimeout         int    `json:"connect_timeout,omitempty" toml:"connect_timeout,omitempty"`                   // in seconds
+	SSLCert                string `json:"sslcert,omitempty" toml:"sslcert,omitempty"`                                   // location if PEM encoded cert file
+	SSLKey                 string `json:"sslkey,omitempty" toml:"sslkey,omitempty"`                                     // location of PEM encoded key file
+	SSLRootCert            string `json:"sslrootcert,omitempty" toml:"sslrootcert,omitempty"`                           // location of PEM encoded root certificate file
+	Eager                  bool   `json:"eager,omitempty" toml:"eager,omitempty"`                                       // connect when the config is loaded rather than on first use
+	BreakerFailures        int    `json:"breaker_failures,omitempty" toml:"breaker_failures,omitempty"`                 // consecutive failures that open the circuit breaker; 0 disables it
+	BreakerCooldownSeconds int    `json:"breaker_cooldown_seconds,omitempty" toml:"breaker_cooldown_seconds,omitempty"` // how long the breaker stays open before a trial. Default: 30
+	SlowQueryMs            int    `json:"slow_query_ms,omitempty" toml:"slow_query_ms,omitempty"`                       // log queries slower than this through the Logger, in ms; 0 disables it
+	h                      *handle[*pgxpool.Pool]
+	secrets                *secrets
+	breaker                *breaker
+	tracer                 trace.Tracer
+	logger                 Logger
+	creds                  CredentialProvider
 }
 
 func (pc *PQConfig) assert() error {
@@ -36,24 +44,27 @@ func (pc *PQConfig) assert() error {
 		return fmt.Errorf("invalid host, user or database name")
 	}
 
-	if pc.SSLMode != "" && pc.SSLMode != "disable" && pc.SSLMode != "verify-ca" && pc.SSLMode != "verify-full" {
+	if pc.SSLMode != "" && pc.SSLMode != "disable" && pc.SSLMode != "require" &&
+		pc.SSLMode != "verify-ca" && pc.SSLMode != "verify-full" {
 		return fmt.Errorf("invalid sslmode: %s", pc.SSLMode)
 	}
 
 	return nil
 }
 
-func (pc *PQConfig) expandEnv() {
-	pc.ID = os.ExpandEnv(pc.ID)
-	pc.Host = os.ExpandEnv(pc.Host)
-	pc.User = os.ExpandEnv(pc.User)
-	pc.Pwd = os.ExpandEnv(pc.Pwd)
-	pc.DB = os.ExpandEnv(pc.DB)
-	pc.SSLMode = os.ExpandEnv(pc.SSLMode)
-	pc.FallbackAppName = os.ExpandEnv(pc.FallbackAppName)
-	pc.SSLCert = os.ExpandEnv(pc.SSLCert)
-	pc.SSLKey = os.ExpandEnv(pc.SSLKey)
-	pc.SSLRootCert = os.ExpandEnv(pc.SSLRootCert)
+func (pc *PQConfig) expandEnv() []error {
+	var e expander
+	e.expand("id", &pc.ID)
+	e.expand("host", &pc.Host)
+	e.expand("user", &pc.User)
+	e.expand("pwd", &pc.Pwd)
+	e.expand("db", &pc.DB)
+	e.expand("sslmode", &pc.SSLMode)
+	e.expand("fallback_application_name", &pc.FallbackAppName)
+	e.expand("sslcert", &pc.SSLCert)
+	e.expand("sslkey", &pc.SSLKey)
+	e.expand("sslrootcert", &pc.SSLRootCert)
+	return e.errs
 }
 
 func (pc *PQConfig) defaults() {
@@ -66,70 +77,130 @@ func (pc *PQConfig) defaults() {
 	}
 }
 
-func (pc *PQConfig) connect() error {
-	var gerr error
-	pc.once.Do(func() {
-		pc.expandEnv()
-		if err := pc.assert(); err != nil {
-			gerr = err
-			return
+// connString builds the keyword/value connection string, resolving
+// a secret reference in pwd
+func (pc *PQConfig) connString(ctx context.Context, sec *secrets) (string, error) {
+	connStr := fmt.Sprintf(
+		"user=%s dbname=%s host=%s port=%d sslmode=%s",
+		pc.User, pc.DB, pc.Host, pc.Port, pc.SSLMode,
+	)
+	if pc.Pwd != "" {
+		pwd, err := sec.resolve(ctx, pc.Pwd)
+		if err != nil {
+			return "", fmt.Errorf("pwd: %s", err.Error())
 		}
+		connStr = fmt.Sprintf("%s password=%s", connStr, pwd)
+	}
 
-		pc.defaults()
+	if pc.FallbackAppName != "" {
+		connStr = fmt.Sprintf("%s fallback_application_name=%s", connStr,
+			pc.FallbackAppName)
+	}
 
-		connStr := fmt.Sprintf(
-			"user=%s dbname=%s host=%s port=%d sslmode=%s",
-			pc.User, pc.DB, pc.Host, pc.Port, pc.SSLMode,
-		)
-		if pc.Pwd != "" {
-			connStr = fmt.Sprintf("%s password=%s", connStr, pc.Pwd)
-		}
+	if pc.ConnectTimeout > 0 {
+		connStr = fmt.Sprintf("%s connect_timeout=%d", connStr,
+			pc.ConnectTimeout)
+	}
 
-		if pc.FallbackAppName != "" {
-			connStr = fmt.Sprintf("%s fallback_application_name=%s", connStr,
-				pc.FallbackAppName)
-		}
+	if pc.SSLCert != "" {
+		connStr = fmt.Sprintf("%s sslcert=%s", connStr,
+			pc.SSLCert)
+	}
 
-		if pc.ConnectTimeout > 0 {
-			connStr = fmt.Sprintf("%s connect_timeout=%d", connStr,
-				pc.ConnectTimeout)
-		}
+	if pc.SSLKey != "" {
+		connStr = fmt.Sprintf("%s sslkey=%s", connStr,
+			pc.SSLKey)
+	}
+
+	if pc.SSLRootCert != "" {
+		connStr = fmt.Sprintf("%s sslrootcert=%s", connStr,
+			pc.SSLRootCert)
+	}
+	return connStr, nil
+}
 
-		if pc.SSLCert != "" {
-			connStr = fmt.Sprintf("%s sslcert=%s", connStr,
-				pc.SSLCert)
+func (pc *PQConfig) connect() error {
+	return pc.connectContext(context.Background())
+}
+
+// connectContext connects the pool, waiting at most until ctx is done.
+// The connect itself isn't bound to ctx since other callers may share it
+func (pc *PQConfig) connectContext(ctx context.Context) error {
+	return pc.h.connectContext(ctx, logConnect(pc.logger, pc, func() error {
+		if err := pc.assert(); err != nil {
+			return blockError(pc, ErrInvalidConfig, err)
 		}
 
-		if pc.SSLKey != "" {
-			connStr = fmt.Sprintf("%s sslkey=%s", connStr,
-				pc.SSLKey)
+		pc.defaults()
+
+		connStr, err := pc.connString(context.Background(), pc.secrets)
+		if err != nil {
+			return blockError(pc, ErrInvalidConfig, err)
 		}
 
-		if pc.SSLRootCert != "" {
-			connStr = fmt.Sprintf("%s sslrootcert=%s", connStr,
-				pc.SSLRootCert)
+		cfg, err := pgxpool.ParseConfig(connStr)
+		if err != nil {
+			return blockError(pc, ErrInvalidConfig, err)
 		}
+		cfg.ConnConfig.DialFunc = pc.breaker.dial(cfg.ConnConfig.DialFunc)
+		cfg.BeforeConnect = beforeConnect(pc, pc.creds, pc.secrets, pc.Pwd)
+		setPgxLogger(cfg.ConnConfig, pc, pc.tracer, newSlowLog(pc.logger, pc, pc.SlowQueryMs))
 
-		p, err := pgxpool.Connect(context.Background(), connStr)
+		p, err := pgxpool.ConnectConfig(context.Background(), cfg)
 		// db, err := sql.Open("postgres", connStr)
 		if err != nil {
-			gerr = err
-			return
+			return err
 		}
-		pc._db = p
-	})
-	if gerr != nil {
-		return gerr
-	}
-	return nil
+		pc.h.conn = p
+		return nil
+	}))
 }
 
-func (pc *PQConfig) db() (*pgxpool.Pool, error) {
-	if err := pc.connect(); err != nil {
-		return nil, fmt.Errorf("[PQConfig.db] -> connect err: %s", err.Error())
+func (pc *PQConfig) db(ctx context.Context) (*pgxpool.Pool, error) {
+	if err := pc.breaker.guard(ctx, pc, pc.connectContext); err != nil {
+		return nil, err
 	}
-	if pc._db == nil {
-		return nil, fmt.Errorf("invalid pq configuration. connection could not be made")
+	if err := pc.connectContext(ctx); err != nil {
+		return nil, blockError(pc, ErrConnect, err)
 	}
-	return pc._db, nil
+	return pc.h.conn, nil
+}
+
+// reset gives pc a new handle that isn't connected yet
+func (pc *PQConfig) reset() { pc.h = &handle[*pgxpool.Pool]{} }
+
+func (pc *PQConfig) backend() string { return "pq" }
+func (pc *PQConfig) ident() string   { return pc.ID }
+func (pc *PQConfig) opened() bool    { return pc.h.isConnected() }
+
+func (pc *PQConfig) open(ctx context.Context) error {
+	_, err := pc.db(ctx)
+	return err
+}
+
+// ping round trips to the server; the block must be open
+func (pc *PQConfig) ping(ctx context.Context) error {
+	return pc.h.conn.Ping(ctx)
+}
+
+func (pc *PQConfig) inUse() int {
+	if !pc.opened() {
+		return 0
+	}
+	return int(pc.h.conn.Stat().AcquiredConns())
+}
+
+func (pc *PQConfig) stats() poolStats {
+	return pgxStats(pc.h.conn.Stat())
+}
+
+func (pc *PQConfig) isEager() bool     { return pc.Eager }
+func (pc *PQConfig) since() time.Time  { return pc.h.since() }
+func (pc *PQConfig) circuit() *breaker { return pc.breaker }
+
+func (pc *PQConfig) close(ctx context.Context) error {
+	return pc.h.close(ctx, logClose(pc.logger, pc, func() error {
+		pc.h.conn.Close()
+		return nil
+	}))
 }
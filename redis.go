@@ -1,13 +1,13 @@
 package dbconnect
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"os"
-	"sync"
+	"net"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // RedisConfig defines the parameters of a redis connection
@@ -39,11 +39,26 @@ type RedisConfig struct {
 	// Close connections older than this duration. If the value is zero, then
 	// the pool does not close connections based on age.
 	MaxConnLifetimeSeconds int `json:"max_conn_lifetime_seconds" toml:"max_conn_lifetime_seconds"`
-	_pool                  *redis.Pool
-	once                   sync.Once
+	// Connect when the config is loaded rather than on first use
+	Eager bool `json:"eager" toml:"eager"`
+	// Consecutive failures that open the circuit breaker; 0 disables it
+	BreakerFailures int `json:"breaker_failures" toml:"breaker_failures"`
+	// How long the breaker stays open before a trial. Default: 30
+	BreakerCooldownSeconds int `json:"breaker_cooldown_seconds" toml:"breaker_cooldown_seconds"`
+	// Log commands slower than this through the Logger, in ms; 0 disables it
+	SlowQueryMs int `json:"slow_query_ms" toml:"slow_query_ms"`
+	h           *handle[*redis.Pool]
+	secrets     *secrets
+	breaker     *breaker
+	tracer      trace.Tracer
+	logger      Logger
 }
 
+// Addr returns host:port of the redis instance; empty when no host is set
 func (rc *RedisConfig) Addr() string {
+	if rc.Host == "" {
+		return ""
+	}
 	return fmt.Sprintf("%s:%d", rc.Host, rc.Port)
 }
 
@@ -54,12 +69,14 @@ func (rc *RedisConfig) assert() error {
 	return nil
 }
 
-func (rc *RedisConfig) expandEnv() {
-	rc.ID = os.ExpandEnv(rc.ID)
-	rc.Network = os.ExpandEnv(rc.Network)
-	rc.Host = os.ExpandEnv(rc.Host)
-	rc.Pwd = os.ExpandEnv(rc.Pwd)
-	rc.RawURL = os.ExpandEnv(rc.RawURL)
+func (rc *RedisConfig) expandEnv() []error {
+	var e expander
+	e.expand("id", &rc.ID)
+	e.expand("network", &rc.Network)
+	e.expand("host", &rc.Host)
+	e.expand("pwd", &rc.Pwd)
+	e.expand("raw_url", &rc.RawURL)
+	return e.errs
 }
 
 func (rc *RedisConfig) defaults() {
@@ -67,6 +84,10 @@ func (rc *RedisConfig) defaults() {
 		rc.Network = "tcp"
 	}
 
+	if rc.Host != "" && rc.Port == 0 {
+		rc.Port = 6379
+	}
+
 	if rc.DialTimeoutSeconds == 0 {
 		rc.DialTimeoutSeconds = 5
 	}
@@ -88,14 +109,13 @@ func (rc *RedisConfig) defaults() {
 	}
 }
 
-func (rc *RedisConfig) connect() {
-	rc.once.Do(func() {
-		rc.expandEnv()
+func (rc *RedisConfig) connect() error {
+	return rc.h.connect(logConnect(rc.logger, rc, func() error {
 		if err := rc.assert(); err != nil {
-			log.Fatal(err.Error())
+			return blockError(rc, ErrInvalidConfig, err)
 		}
 		rc.defaults()
-		rc._pool = &redis.Pool{
+		rc.h.conn = &redis.Pool{
 			MaxIdle:         rc.MaxIdle,
 			MaxActive:       rc.MaxActive,
 			IdleTimeout:     time.Duration(rc.IdleTimeoutMins) * time.Minute,
@@ -105,7 +125,7 @@ func (rc *RedisConfig) connect() {
 				return nil
 			},
 
-			Dial: func() (redis.Conn, error) {
+			DialContext: func(ctx context.Context) (redis.Conn, error) {
 				dops := []redis.DialOption{
 					redis.DialConnectTimeout(time.Duration(rc.DialTimeoutSeconds) * time.Second),
 					redis.DialKeepAlive(time.Duration(rc.KeepAliveMins) * time.Minute),
@@ -113,24 +133,109 @@ func (rc *RedisConfig) connect() {
 					redis.DialWriteTimeout(time.Duration(rc.WriteTimeoutSeconds) * time.Second),
 					redis.DialDatabase(rc.DB),
 				}
+				if rc.breaker != nil {
+					d := net.Dialer{
+						Timeout:   time.Duration(rc.DialTimeoutSeconds) * time.Second,
+						KeepAlive: time.Duration(rc.KeepAliveMins) * time.Minute,
+					}
+					dops = append(dops, redis.DialContextFunc(rc.breaker.dial(d.DialContext)))
+				}
 				if rc.Pwd != "" {
-					dops = append(dops, redis.DialPassword(rc.Pwd))
+					pwd, err := rc.secrets.resolve(ctx, rc.Pwd)
+					if err != nil {
+						return nil, fmt.Errorf("pwd: %s", err.Error())
+					}
+					dops = append(dops, redis.DialPassword(pwd))
 				}
 
 				if rc.Addr() == "" && rc.RawURL != "" {
-					return redis.DialURL(rc.RawURL, dops...)
+					rawURL, err := rc.secrets.resolve(ctx, rc.RawURL)
+					if err != nil {
+						return nil, fmt.Errorf("raw_url: %s", err.Error())
+					}
+					return redis.DialURLContext(ctx, rawURL, dops...)
 				}
 
-				return redis.Dial(rc.Network, rc.Addr(), dops...)
+				return redis.DialContext(ctx, rc.Network, rc.Addr(), dops...)
 			},
 		}
-	})
+		return nil
+	}))
 }
 
 func (rc *RedisConfig) pool() (*redis.Pool, error) {
-	rc.connect()
-	if rc._pool == nil {
-		return nil, fmt.Errorf("invalid redis configuration. pool could not be created")
+	if err := rc.breaker.guard(context.Background(), rc, func(context.Context) error { return rc.connect() }); err != nil {
+		return nil, err
+	}
+	if err := rc.connect(); err != nil {
+		return nil, blockError(rc, ErrConnect, err)
+	}
+	return rc.h.conn, nil
+}
+
+// wrap returns conn as handed out by the getters: guarded by the
+// circuit breaker and traced when configured
+func (rc *RedisConfig) wrap(conn redis.Conn) redis.Conn {
+	if rc.breaker != nil {
+		conn = &breakerConn{Conn: conn, br: rc.breaker}
+	}
+	if sl := newSlowLog(rc.logger, rc, rc.SlowQueryMs); sl != nil {
+		conn = &slowConn{Conn: conn, sl: sl}
+	}
+	if rc.tracer != nil {
+		conn = &tracingConn{Conn: conn, tracer: rc.tracer, b: rc}
+	}
+	return conn
+}
+
+// reset gives rc a new handle that isn't connected yet
+func (rc *RedisConfig) reset() { rc.h = &handle[*redis.Pool]{} }
+
+func (rc *RedisConfig) backend() string { return "redis" }
+func (rc *RedisConfig) ident() string   { return rc.ID }
+func (rc *RedisConfig) opened() bool    { return rc.h.isConnected() }
+
+func (rc *RedisConfig) open(context.Context) error {
+	_, err := rc.pool()
+	return err
+}
+
+// ping round trips to the server; the block must be open
+func (rc *RedisConfig) ping(ctx context.Context) error {
+	conn, err := rc.h.conn.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = redis.DoContext(conn, ctx, "PING")
+	return err
+}
+
+func (rc *RedisConfig) inUse() int {
+	if !rc.opened() {
+		return 0
 	}
-	return rc._pool, nil
+	return rc.h.conn.ActiveCount() - rc.h.conn.IdleCount()
+}
+
+func (rc *RedisConfig) stats() poolStats {
+	st := rc.h.conn.Stats()
+	return poolStats{
+		open:  int64(st.ActiveCount),
+		inUse: int64(st.ActiveCount - st.IdleCount),
+		idle:  int64(st.IdleCount),
+		max:   int64(rc.MaxActive),
+		waits: st.WaitCount,
+		wait:  st.WaitDuration,
+	}
+}
+
+func (rc *RedisConfig) isEager() bool     { return rc.Eager }
+func (rc *RedisConfig) since() time.Time  { return rc.h.since() }
+func (rc *RedisConfig) circuit() *breaker { return rc.breaker }
+
+func (rc *RedisConfig) close(ctx context.Context) error {
+	return rc.h.close(ctx, logClose(rc.logger, rc, func() error {
+		return rc.h.conn.Close()
+	}))
 }
@@ -0,0 +1,273 @@
+package dbconnect
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+)
+
+// block is the behaviour shared by the config of every backend
+type block interface {
+	backend() string
+	ident() string
+	// open connects the block if it isn't connected yet
+	open(ctx context.Context) error
+	// opened reports whether a pool or client was created
+	opened() bool
+	ping(ctx context.Context) error
+	isEager() bool
+	// inUse returns the number of connections currently handed out
+	inUse() int
+	// stats reports the pool of the block; it must be open
+	stats() poolStats
+	// since returns when the block was connected
+	since() time.Time
+	// circuit returns the circuit breaker of the block; nil when disabled
+	circuit() *breaker
+	close(ctx context.Context) error
+}
+
+// ReloadChange describes what happened to a block during a reload
+type ReloadChange string
+
+const (
+	ReloadAdded   ReloadChange = "added"
+	ReloadChanged ReloadChange = "changed"
+	ReloadRemoved ReloadChange = "removed"
+	// ReloadFailed is sent when the config could not be re-read, or when
+	// the new pool of a changed block could not be connected. In the
+	// latter case the old pool stays in use
+	ReloadFailed ReloadChange = "failed"
+)
+
+// ReloadEvent is handed to WatchOptions.OnReload for every block that
+// changed. Backend and ID are empty when the whole config failed to load
+type ReloadEvent struct {
+	Backend string
+	ID      string
+	Change  ReloadChange
+	Err     error
+}
+
+// WatchOptions configures Conns.Watch
+type WatchOptions struct {
+	// Interval between checks of the config files. Default: 5s
+	Interval time.Duration
+	// Grace is how long a replaced or removed pool is kept open, so that
+	// in-flight work can finish, before it is closed. Default: 30s
+	Grace time.Duration
+	// OnReload is called for every block that was added, changed or
+	// removed. Callers that cache a *pgxpool.Pool (or any other pool)
+	// should fetch it again through the getters when they see ReloadChanged
+	OnReload func(ReloadEvent)
+}
+
+func (wo *WatchOptions) defaults() {
+	if wo.Interval <= 0 {
+		wo.Interval = 5 * time.Second
+	}
+
+	if wo.Grace <= 0 {
+		wo.Grace = 30 * time.Second
+	}
+}
+
+// emit logs ev and hands it to opts.OnReload
+func (c *Conns) emit(opts *WatchOptions, ev ReloadEvent) {
+	if ev.Change == ReloadFailed {
+		c.log().Error("config reload failed", "backend", ev.Backend, "id", ev.ID, "err", ev.Err)
+	} else {
+		c.log().Info("config reloaded", "backend", ev.Backend, "id", ev.ID, "change", string(ev.Change))
+	}
+	if opts.OnReload != nil {
+		opts.OnReload(ev)
+	}
+}
+
+// Watch re-reads the config files given to New (including overlays)
+// whenever their contents change, until ctx is done or Close is called.
+// Blocks are compared by id: unchanged blocks keep their connections,
+// changed blocks get a new pool which is swapped in atomically, and the
+// old one is closed after the grace period, or by Close if that comes
+// first. It only works on a Conns created with New
+func (c *Conns) Watch(ctx context.Context, opts WatchOptions) error {
+	if c.reread == nil {
+		return fmt.Errorf("watch requires a Conns created from a config file with New")
+	}
+	opts.defaults()
+
+	sum, err := c.checksum()
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		t := time.NewTicker(opts.Interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-c.done:
+				return
+			case <-t.C:
+			}
+
+			cur, err := c.checksum()
+			if err != nil {
+				c.emit(&opts, ReloadEvent{Change: ReloadFailed, Err: err})
+				continue
+			}
+			if bytes.Equal(cur, sum) {
+				continue
+			}
+			sum = cur
+			c.reload(ctx, &opts)
+		}
+	}()
+	return nil
+}
+
+// checksum hashes the contents of every watched file
+func (c *Conns) checksum() ([]byte, error) {
+	h := sha256.New()
+	for _, p := range c.paths {
+		bs, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		h.Write(bs)
+	}
+	return h.Sum(nil), nil
+}
+
+// reload re-reads the config and swaps in every block that changed
+func (c *Conns) reload(ctx context.Context, opts *WatchOptions) {
+	nc, err := c.reread()
+	if err != nil {
+		c.emit(opts, ReloadEvent{Change: ReloadFailed, Err: err})
+		return
+	}
+
+	c.mu.RLock()
+	old := c.c
+	c.mu.RUnlock()
+
+	var evs []ReloadEvent
+	var retired []block
+	nc.PQ, evs, retired = reconcile(ctx, old.PQ, nc.PQ, evs, retired)
+	nc.CockroachDB, evs, retired = reconcile(ctx, old.CockroachDB, nc.CockroachDB, evs, retired)
+	nc.Redis, evs, retired = reconcile(ctx, old.Redis, nc.Redis, evs, retired)
+	nc.Mongo, evs, retired = reconcile(ctx, old.Mongo, nc.Mongo, evs, retired)
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		// Close only saw the old blocks; close the ones opened above
+		_ = closeBlocks(context.Background(), fresh(old, nc))
+		return
+	}
+	c.c = nc
+	c.index()
+	c.retired = append(c.retired, retired...)
+	c.mu.Unlock()
+
+	for _, b := range retired {
+		b := b
+		time.AfterFunc(opts.Grace, func() {
+			c.retire(b)
+			_ = b.close(context.Background())
+		})
+	}
+	for _, ev := range evs {
+		c.emit(opts, ev)
+	}
+}
+
+// retire drops b from the blocks Close has to close
+func (c *Conns) retire(b block) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, r := range c.retired {
+		if r == b {
+			c.retired = append(c.retired[:i], c.retired[i+1:]...)
+			return
+		}
+	}
+}
+
+// fresh returns the blocks of nc that aren't carried over from old
+func fresh(old, nc *Config) []block {
+	kept := map[block]bool{}
+	for _, b := range old.blocks() {
+		kept[b] = true
+	}
+	var bs []block
+	for _, b := range nc.blocks() {
+		if !kept[b] {
+			bs = append(bs, b)
+		}
+	}
+	return bs
+}
+
+// reconcile matches the blocks of cur against old by id. Unchanged blocks
+// are replaced by their old instance so their connections are kept.
+// A changed block whose old instance was connected is connected right
+// away; if that fails the old instance is kept. Old instances that are no
+// longer used are returned in retired
+func reconcile[T block](ctx context.Context, old, cur []T, evs []ReloadEvent, retired []block) ([]T, []ReloadEvent, []block) {
+	prev := map[string]T{}
+	for _, b := range old {
+		prev[b.ident()] = b
+	}
+
+	for i, b := range cur {
+		o, ok := prev[b.ident()]
+		delete(prev, b.ident())
+		switch {
+		case !ok:
+			evs = append(evs, ReloadEvent{Backend: b.backend(), ID: b.ident(), Change: ReloadAdded})
+		case sameSettings(o, b):
+			cur[i] = o
+		default:
+			if o.opened() {
+				if err := b.open(ctx); err != nil {
+					evs = append(evs, ReloadEvent{Backend: b.backend(), ID: b.ident(), Change: ReloadFailed, Err: err})
+					_ = b.close(ctx)
+					cur[i] = o
+					continue
+				}
+			}
+			retired = append(retired, o)
+			evs = append(evs, ReloadEvent{Backend: b.backend(), ID: b.ident(), Change: ReloadChanged})
+		}
+	}
+
+	for _, o := range old {
+		if _, ok := prev[o.ident()]; !ok {
+			continue
+		}
+		retired = append(retired, o)
+		evs = append(evs, ReloadEvent{Backend: o.backend(), ID: o.ident(), Change: ReloadRemoved})
+	}
+	return cur, evs, retired
+}
+
+// sameSettings compares the exported fields of two blocks of the same type
+func sameSettings(a, b interface{}) bool {
+	va, vb := reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem()
+	for i := 0; i < va.NumField(); i++ {
+		if !va.Type().Field(i).IsExported() {
+			continue
+		}
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			return false
+		}
+	}
+	return true
+}
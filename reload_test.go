@@ -0,0 +1,191 @@
+package dbconnect
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "db.toml")
+	write := func(s string) {
+		if err := os.WriteFile(p, []byte(s), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`
+[[pq]]
+id="main"
+host="old-host"
+user="postgres"
+db="app"
+
+[[pq]]
+id="reports"
+host="reports-host"
+user="postgres"
+db="reports"
+
+[[redis]]
+id="cache"
+host="localhost"
+`)
+
+	conns, err := New(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reports, _ := conns.pq("reports")
+
+	evs := make(chan ReloadEvent, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err = conns.Watch(ctx, WatchOptions{
+		Interval: 10 * time.Millisecond,
+		OnReload: func(ev ReloadEvent) { evs <- ev },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write(`
+[[pq]]
+id="main"
+host="new-host"
+user="postgres"
+db="app"
+
+[[pq]]
+id="reports"
+host="reports-host"
+user="postgres"
+db="reports"
+
+[[mongo]]
+id="docs"
+`)
+
+	var got []string
+	for len(got) < 3 {
+		select {
+		case ev := <-evs:
+			if ev.Err != nil {
+				t.Fatal(ev.Err)
+			}
+			got = append(got, ev.Backend+" "+ev.ID+" "+string(ev.Change))
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for reload events, got %v", got)
+		}
+	}
+	sort.Strings(got)
+	want := []string{"mongo docs added", "pq main changed", "redis cache removed"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got events %v, want %v", got, want)
+		}
+	}
+
+	if pc, _ := conns.pq("main"); pc.Host != "new-host" {
+		t.Fatalf("main was not swapped, host: %s", pc.Host)
+	}
+	if pc, _ := conns.pq("reports"); pc != reports {
+		t.Fatal("unchanged block was replaced")
+	}
+	if _, err := conns.redis("cache"); err == nil {
+		t.Fatal("removed block is still reachable")
+	}
+}
+
+func TestWatchRequiresFile(t *testing.T) {
+	conns, err := NewFromConfig(&Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conns.Watch(context.Background(), WatchOptions{}); err == nil {
+		t.Fatal("was supposed to error")
+	}
+}
+
+func TestWatchClose(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "db.toml")
+	write := func(s string) {
+		if err := os.WriteFile(p, []byte(s), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("[[redis]]\nid=\"cache\"\nhost=\"localhost\"\n")
+
+	rl := &recordLogger{}
+	conns, err := New(p, WithLogger(rl))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// redis pools dial lazily, so they can be opened without a server
+	if _, err := conns.GetRedisPool("cache"); err != nil {
+		t.Fatal(err)
+	}
+	old, _ := conns.redis("cache")
+
+	// the replaced pool is closed by Close, not after the grace period
+	opts := WatchOptions{Grace: time.Hour}
+	write("[[redis]]\nid=\"cache\"\nhost=\"localhost\"\ndb=1\n")
+	conns.reload(context.Background(), &opts)
+	cur, _ := conns.redis("cache")
+	if cur == old || !cur.opened() {
+		t.Fatal("changed block was not swapped in and opened")
+	}
+	if err := conns.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if old.opened() || cur.opened() {
+		t.Fatal("Close left a pool open")
+	}
+
+	// a reload that finds c closed once it connected the new pool closes it
+	rl = &recordLogger{}
+	conns, err = New(p, WithLogger(rl))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conns.GetRedisPool("cache"); err != nil {
+		t.Fatal(err)
+	}
+	conns.mu.Lock()
+	conns.closed = true
+	conns.mu.Unlock()
+	write("[[redis]]\nid=\"cache\"\nhost=\"localhost\"\ndb=2\n")
+	conns.reload(context.Background(), &opts)
+	if rl.find("INFO closed backend=redis id=cache") == "" {
+		t.Fatalf("the new pool was left open: %q", rl.msgs)
+	}
+}
+
+func TestWatchKeepsOptionBlocks(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "db.toml")
+	if err := os.WriteFile(p, []byte("[[redis]]\nid=\"cache\"\nhost=\"localhost\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	conns, err := New(p, WithPostgres("extra", downPQ(&PQConfig{BreakerFailures: 1})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conns.Close(context.Background())
+	if _, err := conns.GetPQ("extra"); err == nil {
+		t.Fatal("expected a connect error")
+	}
+	extra, _ := conns.pq("extra")
+	br := extra.breaker
+
+	if err := os.WriteFile(p, []byte("[[redis]]\nid=\"cache\"\nhost=\"localhost\"\ndb=1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	conns.reload(context.Background(), &WatchOptions{})
+	cur, _ := conns.pq("extra")
+	if bs := conns.Breakers(); cur != extra || cur.breaker != br || len(bs) != 1 || bs[0].State != BreakerOpen {
+		t.Fatal("reload reset the state of a block added through an option")
+	}
+}
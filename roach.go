@@ -3,11 +3,11 @@ package dbconnect
 import (
 	"context"
 	"fmt"
-	"os"
 	"strings"
-	"sync"
+	"time"
 
 	"github.com/jackc/pgx/v4/pgxpool"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type roachOps struct {
@@ -16,20 +16,28 @@ type roachOps struct {
 }
 
 type RoachConfig struct {
-	ID              string   `json:"id,omitempty" toml:"id,omitempty"`
-	Host            string   `json:"host,omitempty" toml:"host,omitempty"`
-	Port            int      `json:"port,omitempty" toml:"port,omitempty"`
-	User            string   `json:"user,omitempty" toml:"user,omitempty"`
-	Pwd             string   `json:"pwd,omitempty" toml:"pwd,omitempty"`
-	DB              string   `json:"db,omitempty" toml:"db,omitempty"`
-	SSLMode         string   `json:"sslmode,omitempty" toml:"sslmode,omitempty"`                   // disable | require | verify-ca | verify-full
-	ApplicationName string   `json:"application_name,omitempty" toml:"application_name,omitempty"` // in seconds
-	SSLCert         string   `json:"sslcert,omitempty" toml:"sslcert,omitempty"`                   // location if PEM encoded cert file
-	SSLKey          string   `json:"sslkey,omitempty" toml:"sslkey,omitempty"`                     // location of PEM encoded key file
-	SSLRootCert     string   `json:"sslrootcert,omitempty" toml:"sslrootcert,omitempty"`           // location of PEM encoded root certificate file
-	Options         roachOps `json:"options,omitempty" toml:"options,omitempty"`
-	_db             *pgxpool.Pool
-	once            sync.Once
+	ID                     string   `json:"id,omitempty" toml:"id,omitempty"`
+	Host                   string   `json:"host,omitempty" toml:"host,omitempty"`
+	Port                   int      `json:"port,omitempty" toml:"port,omitempty"`
+	User                   string   `json:"user,omitempty" toml:"user,omitempty"`
+	Pwd                    string   `json:"pwd,omitempty" toml:"pwd,omitempty"`
+	DB                     string   `json:"db,omitempty" toml:"db,omitempty"`
+	SSLMode                string   `json:"sslmode,omitempty" toml:"sslmode,omitempty"`                   // disable | require | verify-ca | verify-full
+	ApplicationName        string   `json:"application_name,omitempty" toml:"application_name,omitempty"` // in seconds
+	SSLCert                string   `json:"sslcert,omitempty" toml:"sslcert,omitempty"`                   // location if PEM encoded cert file
+	SSLKey                 string   `json:"sslkey,omitempty" toml:"sslkey,omitempty"`                     // location of PEM encoded key file
+	SSLRootCert            string   `json:"sslrootcert,omitempty" toml:"sslrootcert,omitempty"`           // location of PEM encoded root certificate file
+	Options                roachOps `json:"options,omitempty" toml:"options,omitempty"`
+	Eager                  bool     `json:"eager,omitempty" toml:"eager,omitempty"`                                       // connect when the config is loaded rather than on first use
+	BreakerFailures        int      `json:"breaker_failures,omitempty" toml:"breaker_failures,omitempty"`                 // consecutive failures that open the circuit breaker; 0 disables it
+	BreakerCooldownSeconds int      `json:"breaker_cooldown_seconds,omitempty" toml:"breaker_cooldown_seconds,omitempty"` // how long the breaker stays open before a trial. Default: 30
+	SlowQueryMs            int      `json:"slow_query_ms,omitempty" toml:"slow_query_ms,omitempty"`                       // log queries slower than this through the Logger, in ms; 0 disables it
+	h                      *handle[*pgxpool.Pool]
+	secrets                *secrets
+	breaker                *breaker
+	tracer                 trace.Tracer
+	logger                 Logger
+	creds                  CredentialProvider
 }
 
 func (rc *RoachConfig) assert() error {
@@ -37,7 +45,8 @@ func (rc *RoachConfig) assert() error {
 		return fmt.Errorf("invalid host, user or database name")
 	}
 
-	if rc.SSLMode != "require" &&
+	if rc.SSLMode != "" &&
+		rc.SSLMode != "require" &&
 		rc.SSLMode != "disable" &&
 		rc.SSLMode != "verify-ca" &&
 		rc.SSLMode != "verify-full" &&
@@ -59,30 +68,33 @@ func (rc *RoachConfig) defaults() {
 	}
 }
 
-func (rc *RoachConfig) expandEnv() {
-	rc.ID = os.ExpandEnv(rc.ID)
-	rc.Host = os.ExpandEnv(rc.Host)
-	rc.User = os.ExpandEnv(rc.User)
-	rc.Pwd = os.ExpandEnv(rc.Pwd)
-	rc.DB = os.ExpandEnv(rc.DB)
-	rc.SSLMode = os.ExpandEnv(rc.SSLMode)
-	rc.ApplicationName = os.ExpandEnv(rc.ApplicationName)
-	rc.SSLCert = os.ExpandEnv(rc.SSLCert)
-	rc.SSLKey = os.ExpandEnv(rc.SSLKey)
-	rc.SSLRootCert = os.ExpandEnv(rc.SSLRootCert)
-	rc.Options = roachOps{
-		ClusterName: os.ExpandEnv(rc.Options.ClusterName),
-		C:           os.ExpandEnv(rc.Options.C),
-	}
+func (rc *RoachConfig) expandEnv() []error {
+	var e expander
+	e.expand("id", &rc.ID)
+	e.expand("host", &rc.Host)
+	e.expand("user", &rc.User)
+	e.expand("pwd", &rc.Pwd)
+	e.expand("db", &rc.DB)
+	e.expand("sslmode", &rc.SSLMode)
+	e.expand("application_name", &rc.ApplicationName)
+	e.expand("sslcert", &rc.SSLCert)
+	e.expand("sslkey", &rc.SSLKey)
+	e.expand("sslrootcert", &rc.SSLRootCert)
+	e.expand("options.cluster_name", &rc.Options.ClusterName)
+	e.expand("options.c", &rc.Options.C)
+	return e.errs
 }
 
-func (rc RoachConfig) connString() string {
-	(&rc).expandEnv()
+func (rc *RoachConfig) connString(ctx context.Context, sec *secrets) (string, error) {
 	var auth string
 	if rc.User != "" {
 		auth = rc.User
 		if rc.Pwd != "" {
-			auth += ":" + rc.Pwd
+			pwd, err := sec.resolve(ctx, rc.Pwd)
+			if err != nil {
+				return "", fmt.Errorf("pwd: %s", err.Error())
+			}
+			auth += ":" + pwd
 		}
 		auth += "@"
 	}
@@ -130,37 +142,89 @@ func (rc RoachConfig) connString() string {
 	}
 
 	cs := s + qs
-	return cs
+	return cs, nil
 }
 
 func (rc *RoachConfig) connect() error {
-	var gerr error
-	rc.once.Do(func() {
+	return rc.connectContext(context.Background())
+}
+
+// connectContext connects the pool, waiting at most until ctx is done.
+// The connect itself isn't bound to ctx since other callers may share it
+func (rc *RoachConfig) connectContext(ctx context.Context) error {
+	return rc.h.connectContext(ctx, logConnect(rc.logger, rc, func() error {
+		rc.defaults()
 		if err := rc.assert(); err != nil {
-			gerr = err
-			return
+			return blockError(rc, ErrInvalidConfig, err)
 		}
-		rc.defaults()
 
-		p, err := pgxpool.Connect(context.Background(), rc.connString())
+		cs, err := rc.connString(context.Background(), rc.secrets)
 		if err != nil {
-			gerr = err
-			return
+			return blockError(rc, ErrInvalidConfig, err)
 		}
-		rc._db = p
-	})
-	if gerr != nil {
-		return gerr
-	}
-	return nil
+
+		cfg, err := pgxpool.ParseConfig(cs)
+		if err != nil {
+			return blockError(rc, ErrInvalidConfig, err)
+		}
+		cfg.ConnConfig.DialFunc = rc.breaker.dial(cfg.ConnConfig.DialFunc)
+		cfg.BeforeConnect = beforeConnect(rc, rc.creds, rc.secrets, rc.Pwd)
+		setPgxLogger(cfg.ConnConfig, rc, rc.tracer, newSlowLog(rc.logger, rc, rc.SlowQueryMs))
+
+		p, err := pgxpool.ConnectConfig(context.Background(), cfg)
+		if err != nil {
+			return err
+		}
+		rc.h.conn = p
+		return nil
+	}))
 }
 
-func (rc *RoachConfig) db() (*pgxpool.Pool, error) {
-	if err := rc.connect(); err != nil {
-		return nil, fmt.Errorf("[RoachConfig.db] -> connect err: %s", err.Error())
+func (rc *RoachConfig) db(ctx context.Context) (*pgxpool.Pool, error) {
+	if err := rc.breaker.guard(ctx, rc, rc.connectContext); err != nil {
+		return nil, err
 	}
-	if rc._db == nil {
-		return nil, fmt.Errorf("invalid pq configuration. connection could not be made")
+	if err := rc.connectContext(ctx); err != nil {
+		return nil, blockError(rc, ErrConnect, err)
 	}
-	return rc._db, nil
+	return rc.h.conn, nil
+}
+
+// reset gives rc a new handle that isn't connected yet
+func (rc *RoachConfig) reset() { rc.h = &handle[*pgxpool.Pool]{} }
+
+func (rc *RoachConfig) backend() string { return "cockroachdb" }
+func (rc *RoachConfig) ident() string   { return rc.ID }
+func (rc *RoachConfig) opened() bool    { return rc.h.isConnected() }
+
+func (rc *RoachConfig) open(ctx context.Context) error {
+	_, err := rc.db(ctx)
+	return err
+}
+
+// ping round trips to the server; the block must be open
+func (rc *RoachConfig) ping(ctx context.Context) error {
+	return rc.h.conn.Ping(ctx)
+}
+
+func (rc *RoachConfig) inUse() int {
+	if !rc.opened() {
+		return 0
+	}
+	return int(rc.h.conn.Stat().AcquiredConns())
+}
+
+func (rc *RoachConfig) stats() poolStats {
+	return pgxStats(rc.h.conn.Stat())
+}
+
+func (rc *RoachConfig) isEager() bool     { return rc.Eager }
+func (rc *RoachConfig) since() time.Time  { return rc.h.since() }
+func (rc *RoachConfig) circuit() *breaker { return rc.breaker }
+
+func (rc *RoachConfig) close(ctx context.Context) error {
+	return rc.h.close(ctx, logClose(rc.logger, rc, func() error {
+		rc.h.conn.Close()
+		return nil
+	}))
 }
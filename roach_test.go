@@ -47,6 +47,7 @@ func TestRoachConnect(t *testing.T) {
 
 	for _, tst := range tsts {
 		t.Run(tst.name, func(t *testing.T) {
+			tst.rc.reset()
 			if err := tst.rc.connect(); err != nil {
 				if tst.err == nil {
 					t.Fatal(err)
@@ -54,8 +55,8 @@ func TestRoachConnect(t *testing.T) {
 			} else if tst.err != nil {
 				t.Fatal("was supposed to error")
 			}
-			if tst.err == nil && tst.rc._db == nil {
-				t.Fatal("_db instance is empty")
+			if tst.err == nil && tst.rc.h.conn == nil {
+				t.Fatal("pool is empty")
 			}
 		})
 	}
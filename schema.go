@@ -0,0 +1,20 @@
+package dbconnect
+
+import (
+	// embed is imported to ship schema.json with the package
+	_ "embed"
+)
+
+//go:embed schema.json
+var schema []byte
+
+// Schema returns the JSON Schema (draft 2020-12) describing the config
+// format, including allowed values and defaults of every key.
+// It can be used to validate config files before deploying them. The
+// root validates a full base file; overlays only carry the keys they
+// change and are validated against its $defs/overlay instead
+func Schema() []byte {
+	bs := make([]byte, len(schema))
+	copy(bs, schema)
+	return bs
+}
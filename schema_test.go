@@ -0,0 +1,170 @@
+package dbconnect
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// TestSchema keeps schema.json in sync with the json tags of the config types
+func TestSchema(t *testing.T) {
+	type tt struct {
+		name  string
+		props []string // path to the properties object in the schema
+		typ   reflect.Type
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(Schema(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	tsts := []tt{
+		{name: "config", props: []string{"properties"}, typ: reflect.TypeOf(Config{})},
+		{name: "overlay", props: []string{"$defs", "overlay", "properties"}, typ: reflect.TypeOf(Config{})},
+		{name: "pq", props: []string{"$defs", "pq", "properties"}, typ: reflect.TypeOf(PQConfig{})},
+		{name: "cockroachdb", props: []string{"$defs", "cockroachdb", "properties"}, typ: reflect.TypeOf(RoachConfig{})},
+		{name: "cockroachdb options", props: []string{"$defs", "cockroachdb", "properties", "options", "properties"}, typ: reflect.TypeOf(roachOps{})},
+		{name: "redis", props: []string{"$defs", "redis", "properties"}, typ: reflect.TypeOf(RedisConfig{})},
+		{name: "mongo", props: []string{"$defs", "mongo", "properties"}, typ: reflect.TypeOf(MongoConfig{})},
+	}
+
+	for _, tst := range tsts {
+		t.Run(tst.name, func(t *testing.T) {
+			var node interface{} = doc
+			for _, k := range tst.props {
+				m, ok := node.(map[string]interface{})
+				if !ok {
+					t.Fatalf("no %s in schema", strings.Join(tst.props, "."))
+				}
+				node = m[k]
+			}
+			props, ok := node.(map[string]interface{})
+			if !ok {
+				t.Fatalf("no %s in schema", strings.Join(tst.props, "."))
+			}
+
+			var got, want []string
+			for k := range props {
+				if k != profilesKey {
+					got = append(got, k)
+				}
+			}
+			for i := 0; i < tst.typ.NumField(); i++ {
+				f := tst.typ.Field(i)
+				if !f.IsExported() {
+					continue
+				}
+				name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+				want = append(want, name)
+			}
+			sort.Strings(got)
+			sort.Strings(want)
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("schema properties %v don't match json tags %v", got, want)
+			}
+		})
+	}
+}
+
+// TestSchemaEnums keeps the enums of the schema in line with validation
+func TestSchemaEnums(t *testing.T) {
+	var doc struct {
+		Defs map[string]struct {
+			Properties map[string]struct {
+				AnyOf []struct {
+					Enum []string `json:"enum"`
+				} `json:"anyOf"`
+			} `json:"properties"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(Schema(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	enum := func(def, prop string) []string {
+		return doc.Defs[def].Properties[prop].AnyOf[0].Enum
+	}
+	for _, v := range enum("pq", "sslmode") {
+		pc := PQConfig{Host: "h", User: "u", DB: "d", SSLMode: v}
+		if err := pc.assert(); err != nil {
+			t.Fatalf("pq: %s", err.Error())
+		}
+	}
+	for _, v := range enum("cockroachdb", "sslmode") {
+		rc := RoachConfig{Host: "h", User: "u", DB: "d", SSLMode: v}
+		if err := rc.assert(); err != nil {
+			t.Fatalf("cockroachdb: %s", err.Error())
+		}
+	}
+	for _, v := range enum("redis", "network") {
+		rc := RedisConfig{Host: "h", Port: 6379, Network: v}
+		if errs := rc.validate(); len(errs) > 0 {
+			t.Fatalf("redis: %s", errs[0].Error())
+		}
+	}
+}
+
+// TestSchemaOverlay checks that overlays, which only carry the keys they
+// change, aren't held to the required keys of a base file
+func TestSchemaOverlay(t *testing.T) {
+	type node struct {
+		Required []string `json:"required"`
+		Items    struct {
+			Required []string `json:"required"`
+		} `json:"items"`
+	}
+	var doc struct {
+		Properties map[string]node `json:"properties"`
+		Defs       map[string]struct {
+			Required   []string        `json:"required"`
+			Properties map[string]node `json:"properties"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(Schema(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, b := range []string{"pq", "cockroachdb", "redis", "mongo"} {
+		if got := doc.Defs[b].Required; !reflect.DeepEqual(got, []string{"id"}) {
+			t.Errorf("%s blocks of an overlay require %v, want only id", b, got)
+		}
+		if _, ok := doc.Defs["overlay"].Properties[b]; !ok {
+			t.Errorf("overlay has no %s", b)
+		}
+	}
+	for _, b := range []string{"pq", "cockroachdb"} {
+		if got := doc.Properties[b].Items.Required; !reflect.DeepEqual(got, []string{"id", "host", "user", "db"}) {
+			t.Errorf("%s blocks of a base file require %v", b, got)
+		}
+	}
+}
+
+// TestSchemaPort keeps the port range of the schema in line with checkPort
+func TestSchemaPort(t *testing.T) {
+	var doc struct {
+		Defs struct {
+			Port struct {
+				Minimum int `json:"minimum"`
+				Maximum int `json:"maximum"`
+			} `json:"port"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(Schema(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	p := doc.Defs.Port
+	for port, want := range map[int]bool{
+		p.Minimum - 1: false,
+		p.Minimum:     true,
+		p.Maximum:     true,
+		p.Maximum + 1: false,
+	} {
+		if got := len(checkPort(port)) == 0; got != want {
+			t.Errorf("port %d: schema allows it %v, checkPort %v", port, want, got)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package dbconnect
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// secretPrefix marks a config value as a reference to be resolved by a
+// SecretResolver, e.g. "secret://file/run/secrets/pg" or "secret://env/PG_PWD"
+const secretPrefix = "secret://"
+
+// SecretResolver resolves secret references. For a value of
+// "secret://<scheme>/<ref>" the resolver registered for <scheme> is handed <ref>
+type SecretResolver interface {
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// SecretResolverFunc adapts a plain function to a SecretResolver
+type SecretResolverFunc func(ctx context.Context, ref string) (string, error)
+
+// Resolve calls f(ctx, ref)
+func (f SecretResolverFunc) Resolve(ctx context.Context, ref string) (string, error) {
+	return f(ctx, ref)
+}
+
+// FileSecretResolver reads the secret from the file at ref, which is taken
+// relative to the filesystem root: "secret://file/run/secrets/pg" reads
+// /run/secrets/pg. A single trailing newline is dropped.
+// Registered as "file" by default
+type FileSecretResolver struct{}
+
+// Resolve returns the contents of the file at ref
+func (FileSecretResolver) Resolve(_ context.Context, ref string) (string, error) {
+	bs, err := os.ReadFile("/" + strings.TrimPrefix(ref, "/"))
+	if err != nil {
+		return "", err
+	}
+	s := strings.TrimSuffix(string(bs), "\n")
+	return strings.TrimSuffix(s, "\r"), nil
+}
+
+// EnvSecretResolver reads the secret from the environment variable ref.
+// Unlike env expansion an unset variable is an error. Registered as "env" by default
+type EnvSecretResolver struct{}
+
+// Resolve returns the value of the environment variable ref
+func (EnvSecretResolver) Resolve(_ context.Context, ref string) (string, error) {
+	v, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s not set", ref)
+	}
+	return v, nil
+}
+
+// WithSecretResolver registers r for values of the form "secret://<scheme>/<ref>".
+// Registering "file" or "env" replaces the built in resolver
+func WithSecretResolver(scheme string, r SecretResolver) Option {
+	return func(s *settings) {
+		if s.secrets == nil {
+			s.secrets = newSecrets()
+		}
+		s.secrets.resolvers[scheme] = r
+	}
+}
+
+// secrets holds the resolvers known to a Conns instance.
+// A nil *secrets resolves using the built in resolvers only
+type secrets struct {
+	resolvers map[string]SecretResolver
+	// mask makes resolve return a placeholder for every non empty value;
+	// used to build connection strings that are safe to show
+	mask bool
+}
+
+func newSecrets() *secrets {
+	return &secrets{
+		resolvers: map[string]SecretResolver{
+			"file": FileSecretResolver{},
+			"env":  EnvSecretResolver{},
+		},
+	}
+}
+
+func isSecret(v string) bool {
+	return strings.HasPrefix(v, secretPrefix)
+}
+
+// parseSecret splits "secret://<scheme>/<ref>" into scheme and ref
+func parseSecret(v string) (string, string, error) {
+	scheme, ref, ok := strings.Cut(strings.TrimPrefix(v, secretPrefix), "/")
+	if !ok || scheme == "" || ref == "" {
+		return "", "", fmt.Errorf("invalid secret reference, expected secret://<scheme>/<ref>")
+	}
+	return scheme, ref, nil
+}
+
+func (s *secrets) resolver(scheme string) (SecretResolver, bool) {
+	if s == nil {
+		s = newSecrets()
+	}
+	r, ok := s.resolvers[scheme]
+	return r, ok
+}
+
+// resolve returns v unchanged unless it is a secret reference, in which
+// case the registered resolver is asked for the actual value
+func (s *secrets) resolve(ctx context.Context, v string) (string, error) {
+	if s != nil && s.mask && v != "" {
+		return masked, nil
+	}
+	if !isSecret(v) {
+		return v, nil
+	}
+	scheme, ref, err := parseSecret(v)
+	if err != nil {
+		return "", err
+	}
+	r, ok := s.resolver(scheme)
+	if !ok {
+		return "", fmt.Errorf("no secret resolver registered for scheme: %s", scheme)
+	}
+	return r.Resolve(ctx, ref)
+}
+
+// check reports every malformed secret reference or reference to an
+// unregistered scheme in c, without resolving any of them
+func (s *secrets) check(c *Config) error {
+	var ve ValidationError
+	add := func(backend, id string, fields map[string]string) {
+		var errs []error
+		for _, k := range []string{"pwd", "connectionString", "raw_url"} {
+			v, ok := fields[k]
+			if !ok || !isSecret(v) {
+				continue
+			}
+			scheme, _, err := parseSecret(v)
+			if err == nil {
+				if _, ok := s.resolver(scheme); !ok {
+					err = fmt.Errorf("no secret resolver registered for scheme: %s", scheme)
+				}
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %s", k, err.Error()))
+			}
+		}
+		ve.add(backend, id, errs)
+	}
+
+	for _, pc := range c.PQ {
+		add("pq", pc.ID, map[string]string{"pwd": pc.Pwd})
+	}
+	for _, rc := range c.CockroachDB {
+		add("cockroachdb", rc.ID, map[string]string{"pwd": rc.Pwd})
+	}
+	for _, rc := range c.Redis {
+		add("redis", rc.ID, map[string]string{"pwd": rc.Pwd, "raw_url": rc.RawURL})
+	}
+	for _, mc := range c.Mongo {
+		add("mongo", mc.ID, map[string]string{"pwd": mc.Pwd, "connectionString": mc.ConnectionString})
+	}
+
+	return ve.Problems.orNil(&ve)
+}
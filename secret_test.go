@@ -0,0 +1,140 @@
+package dbconnect
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+func TestSecretResolve(t *testing.T) {
+	type tt struct {
+		name string
+		v    string
+		want string
+		err  bool
+	}
+
+	f := filepath.Join(t.TempDir(), "pg")
+	if err := os.WriteFile(f, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DBC_TEST_SECRET", "from-env")
+
+	s := newSecrets()
+	s.resolvers["vault"] = SecretResolverFunc(func(_ context.Context, ref string) (string, error) {
+		return "vault:" + ref, nil
+	})
+
+	tsts := []tt{
+		{name: "plain value", v: "plain", want: "plain"},
+		{name: "file", v: "secret://file" + f, want: "from-file"},
+		{name: "env", v: "secret://env/DBC_TEST_SECRET", want: "from-env"},
+		{name: "unset env", v: "secret://env/DBC_TEST_SECRET_UNSET", err: true},
+		{name: "custom", v: "secret://vault/kv/pg#pwd", want: "vault:kv/pg#pwd"},
+		{name: "unknown scheme", v: "secret://aws/pg", err: true},
+		{name: "malformed", v: "secret://env", err: true},
+	}
+
+	for _, tst := range tsts {
+		t.Run(tst.name, func(t *testing.T) {
+			got, err := s.resolve(context.Background(), tst.v)
+			if err != nil {
+				if !tst.err {
+					t.Fatal(err)
+				}
+				return
+			} else if tst.err {
+				t.Fatal("was supposed to error")
+			}
+			if got != tst.want {
+				t.Fatalf("got %s, want %s", got, tst.want)
+			}
+		})
+	}
+}
+
+func TestSecretCheck(t *testing.T) {
+	c := func() *Config {
+		return &Config{
+			PQ: []*PQConfig{{
+				ID: "main", Host: "localhost", User: "postgres", DB: "app",
+				Pwd: "secret://vault/kv/pg",
+			}},
+		}
+	}
+
+	if _, err := NewFromConfig(c()); err == nil {
+		t.Fatal("unregistered scheme was supposed to error")
+	}
+
+	vault := SecretResolverFunc(func(_ context.Context, ref string) (string, error) {
+		return ref, nil
+	})
+	if _, err := NewFromConfig(c(), WithSecretResolver("vault", vault)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSSLKeyPath(t *testing.T) {
+	dir := t.TempDir()
+	cert, key := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	writeKeyPair(t, cert, key)
+
+	pc := &PQConfig{ID: "main", Host: "localhost", Port: 5432, User: "postgres", DB: "app",
+		SSLMode: "require", SSLCert: cert, SSLKey: key}
+	rc := &RoachConfig{ID: "crdb", Host: "localhost", Port: 26257, User: "root", DB: "app",
+		SSLMode: "require", SSLCert: cert, SSLKey: key}
+	for _, cs := range []func(context.Context, *secrets) (string, error){pc.connString, rc.connString} {
+		s, err := cs(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := pgxpool.ParseConfig(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc := cfg.ConnConfig.TLSConfig; tc == nil || len(tc.Certificates) != 1 {
+			t.Fatalf("client key pair of %q wasn't loaded", s)
+		}
+	}
+
+	pc.SSLKey = "secret://env/DBC_TEST_SSLKEY"
+	if _, err := NewFromConfig(&Config{PQ: []*PQConfig{pc}}); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("got %v, want a secret reference in sslkey rejected", err)
+	}
+}
+
+// writeKeyPair writes a self-signed certificate and its key as PEM files
+func writeKeyPair(t *testing.T, certPath, keyPath string) {
+	t.Helper()
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &k.PublicKey, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kder, err := x509.MarshalECPrivateKey(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kder}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
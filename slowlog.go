@@ -0,0 +1,265 @@
+package dbconnect
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jackc/pgx/v4"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// slowLog logs the queries and commands of a block that take longer than
+// its slow_query_ms setting
+type slowLog struct {
+	l         Logger
+	b         block
+	threshold time.Duration
+	// statements of in-flight mongo commands by request id
+	statements sync.Map
+}
+
+// newSlowLog returns nil when ms is 0 or there is no logger to write to
+func newSlowLog(l Logger, b block, ms int) *slowLog {
+	if l == nil || ms <= 0 {
+		return nil
+	}
+	return &slowLog{l: l, b: b, threshold: time.Duration(ms) * time.Millisecond}
+}
+
+// check logs statement when d exceeds the threshold
+func (sl *slowLog) check(d time.Duration, statement string) {
+	if d < sl.threshold {
+		return
+	}
+	sl.l.Warn("slow query", "backend", sl.b.backend(), "id", sl.b.ident(),
+		"duration", d, "statement", statement, "caller", caller())
+}
+
+// Log implements pgx.Logger; pgx hands it the duration of every query
+func (sl *slowLog) Log(_ context.Context, _ pgx.LogLevel, _ string, data map[string]interface{}) {
+	d, ok := data["time"].(time.Duration)
+	if !ok {
+		return
+	}
+	sql, _ := data["sql"].(string)
+	sl.check(d, sanitizeSQL(sql))
+}
+
+func (sl *slowLog) monitor() *event.CommandMonitor {
+	finished := func(e event.CommandFinishedEvent) {
+		if st, ok := sl.statements.LoadAndDelete(e.RequestID); ok {
+			sl.check(time.Duration(e.DurationNanos), st.(string))
+		}
+	}
+	return &event.CommandMonitor{
+		Started: func(_ context.Context, e *event.CommandStartedEvent) {
+			sl.statements.Store(e.RequestID, mongoStatement(e.Command))
+		},
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			finished(e.CommandFinishedEvent)
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			finished(e.CommandFinishedEvent)
+		},
+	}
+}
+
+// pgxLoggers hands every message to each of its loggers
+type pgxLoggers []pgx.Logger
+
+func (ls pgxLoggers) Log(ctx context.Context, level pgx.LogLevel, msg string, data map[string]interface{}) {
+	for _, l := range ls {
+		l.Log(ctx, level, msg, data)
+	}
+}
+
+// setPgxLogger sets the query tracing and slow query logging of b on cc,
+// when either is on
+func setPgxLogger(cc *pgx.ConnConfig, b block, tracer trace.Tracer, sl *slowLog) {
+	var ls pgxLoggers
+	if tracer != nil {
+		ls = append(ls, &pgxTracer{tracer: tracer, b: b})
+	}
+	if sl != nil {
+		ls = append(ls, sl)
+	}
+	if len(ls) == 0 {
+		return
+	}
+	cc.Logger = ls
+	cc.LogLevel = pgx.LogLevelInfo
+}
+
+// chainMonitors returns a monitor calling each of ms; nil ones are skipped
+func chainMonitors(ms ...*event.CommandMonitor) *event.CommandMonitor {
+	var live []*event.CommandMonitor
+	for _, m := range ms {
+		if m != nil {
+			live = append(live, m)
+		}
+	}
+	switch len(live) {
+	case 0:
+		return nil
+	case 1:
+		return live[0]
+	}
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			for _, m := range live {
+				m.Started(ctx, e)
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			for _, m := range live {
+				m.Succeeded(ctx, e)
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			for _, m := range live {
+				m.Failed(ctx, e)
+			}
+		},
+	}
+}
+
+// slowConn is the redis.Conn handed out by GetRedisConn when slow_query_ms
+// is set; it times every Do, and every pipelined command from its Send
+// until its reply is received
+type slowConn struct {
+	redis.Conn
+	sl *slowLog
+
+	// mu guards pending; redigo allows a Send and a Receive at the same time
+	mu      sync.Mutex
+	pending []sent
+}
+
+// sent is a pipelined command waiting for its reply
+type sent struct {
+	stmt string
+	at   time.Time
+}
+
+func (sc *slowConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	start := time.Now()
+	reply, err := sc.Conn.Do(cmd, args...)
+	sc.done(start, cmd, args)
+	return reply, err
+}
+
+func (sc *slowConn) DoContext(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	start := time.Now()
+	reply, err := redis.DoContext(sc.Conn, ctx, cmd, args...)
+	sc.done(start, cmd, args)
+	return reply, err
+}
+
+func (sc *slowConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	start := time.Now()
+	reply, err := redis.DoWithTimeout(sc.Conn, timeout, cmd, args...)
+	sc.done(start, cmd, args)
+	return reply, err
+}
+
+func (sc *slowConn) Send(cmd string, args ...interface{}) error {
+	at := time.Now()
+	if err := sc.Conn.Send(cmd, args...); err != nil {
+		return err
+	}
+	sc.mu.Lock()
+	sc.pending = append(sc.pending, sent{stmt: redisStatement(cmd, args), at: at})
+	sc.mu.Unlock()
+	return nil
+}
+
+func (sc *slowConn) Receive() (interface{}, error) {
+	reply, err := sc.Conn.Receive()
+	sc.received()
+	return reply, err
+}
+
+func (sc *slowConn) ReceiveContext(ctx context.Context) (interface{}, error) {
+	reply, err := redis.ReceiveContext(sc.Conn, ctx)
+	sc.received()
+	return reply, err
+}
+
+func (sc *slowConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	reply, err := redis.ReceiveWithTimeout(sc.Conn, timeout)
+	sc.received()
+	return reply, err
+}
+
+// done checks a Do that started at start. Do reads the replies of every
+// pipelined command before its own, so those are done as well; a Do with
+// an empty cmd only does that
+func (sc *slowConn) done(start time.Time, cmd string, args []interface{}) {
+	sc.mu.Lock()
+	pending := sc.pending
+	sc.pending = nil
+	sc.mu.Unlock()
+	for _, s := range pending {
+		sc.sl.check(time.Since(s.at), s.stmt)
+	}
+	if cmd != "" {
+		sc.sl.check(time.Since(start), redisStatement(cmd, args))
+	}
+}
+
+// received checks the oldest pipelined command, whose reply was just read.
+// Replies nothing was sent for, e.g. pub/sub messages, aren't timed
+func (sc *slowConn) received() {
+	sc.mu.Lock()
+	if len(sc.pending) == 0 {
+		sc.mu.Unlock()
+		return
+	}
+	s := sc.pending[0]
+	sc.pending = sc.pending[1:]
+	sc.mu.Unlock()
+	sc.sl.check(time.Since(s.at), s.stmt)
+}
+
+// driverPkgs are the packages caller skips besides dbconnect itself
+var driverPkgs = []string{
+	"runtime.",
+	"github.com/jackc/",
+	"github.com/gomodule/redigo/",
+	"go.mongodb.org/mongo-driver/",
+}
+
+// caller returns file:line of the first frame outside dbconnect and the
+// drivers, i.e. the code that ran the query
+func caller() string {
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		f, more := frames.Next()
+		if !internalFrame(f) {
+			return fmt.Sprintf("%s:%d", f.File, f.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+func internalFrame(f runtime.Frame) bool {
+	if strings.HasPrefix(f.Function, tracerName+".") {
+		// tests of dbconnect run queries like any other caller
+		return !strings.HasSuffix(f.File, "_test.go")
+	}
+	for _, p := range driverPkgs {
+		if strings.HasPrefix(f.Function, p) {
+			return true
+		}
+	}
+	return false
+}
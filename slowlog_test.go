@@ -0,0 +1,121 @@
+package dbconnect
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jackc/pgx/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// sleepyConn takes d to answer every command
+type sleepyConn struct {
+	redis.Conn
+	d time.Duration
+}
+
+func (sc sleepyConn) Do(string, ...interface{}) (interface{}, error) {
+	time.Sleep(sc.d)
+	return "OK", nil
+}
+
+func (sc sleepyConn) Send(string, ...interface{}) error { return nil }
+
+func (sc sleepyConn) Receive() (interface{}, error) {
+	time.Sleep(sc.d)
+	return "OK", nil
+}
+
+func TestSlowLog(t *testing.T) {
+	if newSlowLog(&recordLogger{}, &PQConfig{}, 0) != nil || newSlowLog(nil, &PQConfig{}, 200) != nil {
+		t.Fatal("slow query logging is off without a threshold or a logger")
+	}
+
+	rl := &recordLogger{}
+	sl := newSlowLog(rl, &PQConfig{ID: "main"}, 200)
+	sl.Log(context.Background(), pgx.LogLevelInfo, "Query", map[string]interface{}{
+		"sql":  "SELECT * FROM users WHERE email = 'bob@example.com'",
+		"time": 10 * time.Millisecond,
+	})
+	if len(rl.msgs) != 0 {
+		t.Fatalf("fast query logged: %q", rl.msgs)
+	}
+	sl.Log(context.Background(), pgx.LogLevelInfo, "Query", map[string]interface{}{
+		"sql":  "SELECT * FROM users WHERE email = 'bob@example.com'",
+		"time": 300 * time.Millisecond,
+	})
+	got := rl.find("WARN slow query backend=pq id=main duration=300ms statement=SELECT * FROM users WHERE email = ? caller=")
+	if !strings.Contains(got, "slowlog_test.go:") {
+		t.Fatalf("got %q, want the slow query with its caller", rl.msgs)
+	}
+}
+
+func TestSlowConn(t *testing.T) {
+	rl := &recordLogger{}
+	rc := &RedisConfig{ID: "cache"}
+	conn := &slowConn{Conn: sleepyConn{d: 5 * time.Millisecond}, sl: newSlowLog(rl, rc, 1)}
+	if _, err := conn.Do("SET", "session:42", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	got := rl.find("WARN slow query backend=redis id=cache")
+	if !strings.Contains(got, "statement=SET ? ?") || !strings.Contains(got, "slowlog_test.go:") {
+		t.Fatalf("got %q", rl.msgs)
+	}
+	if strings.Contains(got, "secret") {
+		t.Fatalf("arguments leaked: %q", got)
+	}
+
+	// pipelined commands are timed from their Send to their reply
+	rl.msgs = nil
+	for _, key := range []string{"a", "b"} {
+		if err := conn.Send("GET", key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := conn.Receive(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Do(""); err != nil {
+		t.Fatal(err)
+	}
+	if len(rl.msgs) != 2 || rl.find("WARN slow query backend=redis id=cache") == "" ||
+		!strings.Contains(rl.msgs[1], "statement=GET ?") {
+		t.Fatalf("got %q, want both pipelined commands", rl.msgs)
+	}
+
+	rc.logger, rc.SlowQueryMs = rl, 1
+	if _, ok := rc.wrap(sleepyConn{}).(*slowConn); !ok {
+		t.Fatal("GetRedisConn conns aren't timed with slow_query_ms set")
+	}
+}
+
+func TestSlowLogMongo(t *testing.T) {
+	rl := &recordLogger{}
+	sl := newSlowLog(rl, &MongoConfig{ID: "docs"}, 100)
+	calls := 0
+	m := chainMonitors(nil, sl.monitor(), &event.CommandMonitor{
+		Started:   func(context.Context, *event.CommandStartedEvent) { calls++ },
+		Succeeded: func(context.Context, *event.CommandSucceededEvent) { calls++ },
+		Failed:    func(context.Context, *event.CommandFailedEvent) { calls++ },
+	})
+
+	cmd, err := bson.Marshal(bson.D{{Key: "find", Value: "users"}, {Key: "filter", Value: bson.D{{Key: "email", Value: "bob"}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Started(context.Background(), &event.CommandStartedEvent{Command: cmd, CommandName: "find", RequestID: 1})
+	m.Failed(context.Background(), &event.CommandFailedEvent{
+		CommandFinishedEvent: event.CommandFinishedEvent{RequestID: 1, DurationNanos: int64(time.Second)},
+		Failure:              "timeout",
+	})
+	if calls != 2 {
+		t.Fatalf("chained monitor called %d times, want 2", calls)
+	}
+	if rl.find(`WARN slow query backend=mongo id=docs duration=1s statement={"find": "users", "filter": ?}`) == "" {
+		t.Fatalf("got %q", rl.msgs)
+	}
+}
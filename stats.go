@@ -0,0 +1,77 @@
+package dbconnect
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// PoolStats is a snapshot of the pool of an opened block, the same for
+// every driver. Counters a driver doesn't keep are 0: redis has no acquire
+// or failure counts and mongo has no wait counts
+type PoolStats struct {
+	Backend string `json:"backend"`
+	ID      string `json:"id"`
+	Open    int64  `json:"open"`
+	Idle    int64  `json:"idle"`
+	InUse   int64  `json:"in_use"`
+	// Max is the configured size limit; 0 when unlimited
+	Max int64 `json:"max"`
+	// Acquires counts every connection handed out of the pool
+	Acquires int64 `json:"acquires"`
+	// Waits counts the acquires that had to wait for a connection
+	Waits int64 `json:"waits"`
+	// WaitTime is the total time spent acquiring connections
+	WaitTime time.Duration `json:"-"`
+	// AcquireFailures counts the acquires that failed or were canceled
+	AcquireFailures int64     `json:"acquire_failures"`
+	ConnectedAt     time.Time `json:"connected_at"`
+	// Uptime is the time since ConnectedAt when the snapshot was taken
+	Uptime time.Duration `json:"-"`
+}
+
+// MarshalJSON renders WaitTime in milliseconds and Uptime in seconds
+func (ps PoolStats) MarshalJSON() ([]byte, error) {
+	type plain PoolStats
+	return json.Marshal(struct {
+		plain
+		WaitMS        float64 `json:"wait_ms"`
+		UptimeSeconds float64 `json:"uptime_seconds"`
+	}{
+		plain:         plain(ps),
+		WaitMS:        float64(ps.WaitTime) / float64(time.Millisecond),
+		UptimeSeconds: ps.Uptime.Seconds(),
+	})
+}
+
+// Stats returns a snapshot of the pool of every opened block in config
+// order, whichever driver is underneath. Blocks that weren't connected
+// yet are left out
+func (c *Conns) Stats() []PoolStats {
+	c.mu.RLock()
+	all := c.c.blocks()
+	c.mu.RUnlock()
+
+	now := time.Now()
+	var ps []PoolStats
+	for _, b := range all {
+		if !b.opened() {
+			continue
+		}
+		st, at := b.stats(), b.since()
+		ps = append(ps, PoolStats{
+			Backend:         b.backend(),
+			ID:              b.ident(),
+			Open:            st.open,
+			Idle:            st.idle,
+			InUse:           st.inUse,
+			Max:             st.max,
+			Acquires:        st.acquires,
+			Waits:           st.waits,
+			WaitTime:        st.wait,
+			AcquireFailures: st.failures,
+			ConnectedAt:     at,
+			Uptime:          now.Sub(at),
+		})
+	}
+	return ps
+}
@@ -0,0 +1,50 @@
+package dbconnect
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	addr := listen(t)
+	conns, err := Build(
+		WithRedis("cache", &RedisConfig{Host: "127.0.0.1", Port: addr.Port, MaxActive: 8}),
+		WithRedis("lazy", &RedisConfig{Host: "127.0.0.1", Port: addr.Port}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conns.Close(context.Background())
+
+	before := time.Now()
+	conn, err := conns.GetRedisConnContext(context.Background(), "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ps := conns.Stats()
+	if len(ps) != 1 || ps[0].ID != "cache" || ps[0].Backend != "redis" {
+		t.Fatalf("got %+v, want only the opened block", ps)
+	}
+	st := ps[0]
+	if st.Open != 1 || st.InUse != 1 || st.Idle != 0 || st.Max != 8 {
+		t.Fatalf("got %+v, want 1 connection in use of 8", st)
+	}
+	if st.ConnectedAt.Before(before) || st.Uptime < 0 || st.Uptime > time.Since(before) {
+		t.Fatalf("got connected at %v, up for %v", st.ConnectedAt, st.Uptime)
+	}
+
+	bs, err := json.Marshal(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{`"in_use":1`, `"max":8`, `"wait_ms":`, `"uptime_seconds":`, `"connected_at":`} {
+		if !strings.Contains(string(bs), key) {
+			t.Fatalf("missing %s in %s", key, bs)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package dbconnect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jackc/pgx/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation name of the spans dbconnect starts
+const tracerName = "github.com/enalk-com/dbconnect"
+
+// WithTracerProvider turns on tracing: every postgresql and cockroachdb
+// query, every command on a redis conn from GetRedisConn and every mongo
+// command gets a client span, a child of the span in the context the call
+// was made with. Spans carry db.system, dbconnect.id and db.statement with
+// literal values replaced by ?. Redis commands only have a context when
+// called through redis.DoContext
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(s *settings) {
+		s.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// dbSystem returns the db.system attribute value of a backend
+func dbSystem(backend string) string {
+	switch backend {
+	case "pq":
+		return "postgresql"
+	case "mongo":
+		return "mongodb"
+	default:
+		return backend
+	}
+}
+
+// startSpan starts a client span for b named name
+func startSpan(ctx context.Context, tracer trace.Tracer, b block, name, statement string, opts ...trace.SpanStartOption) trace.Span {
+	opts = append(opts,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", dbSystem(b.backend())),
+			attribute.String("dbconnect.id", b.ident()),
+			attribute.String("db.statement", statement),
+		))
+	_, span := tracer.Start(ctx, name, opts...)
+	return span
+}
+
+// endSpan ends span, marking it failed when err is set
+func endSpan(span trace.Span, err error, opts ...trace.SpanEndOption) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End(opts...)
+}
+
+// pgxTracer records a span for every query of a pgx pool. pgx v4 has no
+// tracing hooks, but its logger is handed the context and the duration of
+// every query, so the span is recorded once the query is done
+type pgxTracer struct {
+	tracer trace.Tracer
+	b      block
+}
+
+func (pt *pgxTracer) Log(ctx context.Context, _ pgx.LogLevel, msg string, data map[string]interface{}) {
+	d, ok := data["time"].(time.Duration)
+	if !ok {
+		// not a query, e.g. dialing or closing a connection
+		return
+	}
+	end := time.Now()
+	sql, _ := data["sql"].(string)
+	span := startSpan(ctx, pt.tracer, pt.b, msg, sanitizeSQL(sql), trace.WithTimestamp(end.Add(-d)))
+	err, _ := data["err"].(error)
+	endSpan(span, err, trace.WithTimestamp(end))
+}
+
+// sanitizeSQL replaces string and numeric literals of sql with ?.
+// Placeholders such as $1 are kept; their arguments are never recorded
+func sanitizeSQL(sql string) string {
+	var sb strings.Builder
+	for i := 0; i < len(sql); i++ {
+		ch := sql[i]
+		switch {
+		case ch == '\'':
+			// skip to the closing quote; '' is an escaped quote
+			for i++; i < len(sql); i++ {
+				if sql[i] == '\'' {
+					if i+1 < len(sql) && sql[i+1] == '\'' {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			sb.WriteByte('?')
+		case isDigit(ch) && (i == 0 || !isNameChar(sql[i-1]) && sql[i-1] != '$'):
+			for i+1 < len(sql) && (isDigit(sql[i+1]) || sql[i+1] == '.') {
+				i++
+			}
+			sb.WriteByte('?')
+		default:
+			sb.WriteByte(ch)
+		}
+	}
+	return sb.String()
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+// redisStatement is cmd with every argument replaced by ?
+func redisStatement(cmd string, args []interface{}) string {
+	return strings.TrimSpace(cmd + strings.Repeat(" ?", len(args)))
+}
+
+// tracingConn is the redis.Conn handed out by GetRedisConn when tracing
+// is on; it records a span for every Do and Send
+type tracingConn struct {
+	redis.Conn
+	tracer trace.Tracer
+	b      block
+}
+
+func (tc *tracingConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	return tc.DoContext(context.Background(), cmd, args...)
+}
+
+func (tc *tracingConn) DoContext(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	span := startSpan(ctx, tc.tracer, tc.b, cmd, redisStatement(cmd, args))
+	reply, err := redis.DoContext(tc.Conn, ctx, cmd, args...)
+	endSpan(span, replyErr(err))
+	return reply, err
+}
+
+func (tc *tracingConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	span := startSpan(context.Background(), tc.tracer, tc.b, cmd, redisStatement(cmd, args))
+	reply, err := redis.DoWithTimeout(tc.Conn, timeout, cmd, args...)
+	endSpan(span, replyErr(err))
+	return reply, err
+}
+
+func (tc *tracingConn) Send(cmd string, args ...interface{}) error {
+	span := startSpan(context.Background(), tc.tracer, tc.b, cmd, redisStatement(cmd, args))
+	err := tc.Conn.Send(cmd, args...)
+	endSpan(span, err)
+	return err
+}
+
+func (tc *tracingConn) ReceiveContext(ctx context.Context) (interface{}, error) {
+	return redis.ReceiveContext(tc.Conn, ctx)
+}
+
+func (tc *tracingConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return redis.ReceiveWithTimeout(tc.Conn, timeout)
+}
+
+// replyErr drops redis.Error replies such as WRONGTYPE; only failures to
+// talk to the server mark a span failed
+func replyErr(err error) error {
+	var rerr redis.Error
+	if errors.As(err, &rerr) {
+		return nil
+	}
+	return err
+}
+
+// mongoTracer records a span for every command of a mongo client
+type mongoTracer struct {
+	tracer trace.Tracer
+	b      block
+	spans  sync.Map // request id -> trace.Span
+}
+
+func (mt *mongoTracer) monitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			span := startSpan(ctx, mt.tracer, mt.b, e.CommandName, mongoStatement(e.Command),
+				trace.WithAttributes(
+					attribute.String("db.name", e.DatabaseName),
+					attribute.String("db.operation", e.CommandName),
+				))
+			mt.spans.Store(e.RequestID, span)
+		},
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			if span, ok := mt.spans.LoadAndDelete(e.RequestID); ok {
+				endSpan(span.(trace.Span), nil)
+			}
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			if span, ok := mt.spans.LoadAndDelete(e.RequestID); ok {
+				endSpan(span.(trace.Span), errors.New(e.Failure))
+			}
+		},
+	}
+}
+
+// mongoStatement renders the top level keys of cmd with every value but
+// the collection replaced by ?, e.g. {"find": "users", "filter": ?}.
+// Driver internals such as lsid and $db are left out
+func mongoStatement(cmd bson.Raw) string {
+	elems, err := cmd.Elements()
+	if err != nil || len(elems) == 0 {
+		return ""
+	}
+
+	parts := []string{fmt.Sprintf("%q: %s", elems[0].Key(), elems[0].Value().String())}
+	for _, el := range elems[1:] {
+		k := el.Key()
+		if strings.HasPrefix(k, "$") || k == "lsid" || k == "txnNumber" {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%q: ?", k))
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
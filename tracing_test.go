@@ -0,0 +1,120 @@
+package dbconnect
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSanitizeSQL(t *testing.T) {
+	tsts := []struct {
+		sql  string
+		want string
+	}{
+		{"SELECT * FROM users WHERE id = $1", "SELECT * FROM users WHERE id = $1"},
+		{"SELECT * FROM users WHERE name = 'bob' AND pwd = 'it''s'", "SELECT * FROM users WHERE name = ? AND pwd = ?"},
+		{"SELECT * FROM t2 LIMIT 10 OFFSET 2.5", "SELECT * FROM t2 LIMIT ? OFFSET ?"},
+		{"SELECT 'unterminated", "SELECT ?"},
+	}
+	for _, tst := range tsts {
+		if got := sanitizeSQL(tst.sql); got != tst.want {
+			t.Errorf("sanitizeSQL(%q) = %q, want %q", tst.sql, got, tst.want)
+		}
+	}
+}
+
+func TestMongoStatement(t *testing.T) {
+	cmd, err := bson.Marshal(bson.D{
+		{Key: "find", Value: "users"},
+		{Key: "filter", Value: bson.D{{Key: "email", Value: "bob@example.com"}}},
+		{Key: "lsid", Value: bson.D{{Key: "id", Value: 1}}},
+		{Key: "$db", Value: "app"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := mongoStatement(cmd), `{"find": "users", "filter": ?}`; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+// attrs returns the attributes of span as a map
+func attrs(span sdktrace.ReadOnlySpan) map[attribute.Key]string {
+	m := map[attribute.Key]string{}
+	for _, kv := range span.Attributes() {
+		m[kv.Key] = kv.Value.Emit()
+	}
+	return m
+}
+
+func TestTracing(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	addr := listen(t)
+	conns, err := Build(
+		WithRedis("cache", &RedisConfig{Host: "127.0.0.1", Port: addr.Port}),
+		WithPostgres("main", &PQConfig{Host: "localhost", User: "app", DB: "app"}),
+		WithTracerProvider(tp),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conns.Close(context.Background())
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "request")
+	conn, err := conns.GetRedisConnContext(ctx, "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := redis.DoContext(conn, ctx, "SET", "session:42", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	// pgx hands every finished query to its logger
+	pc, _ := conns.pq("main")
+	pt := &pgxTracer{tracer: pc.tracer, b: pc}
+	pt.Log(ctx, 0, "Query", map[string]interface{}{
+		"sql":  "SELECT * FROM users WHERE email = 'bob@example.com'",
+		"time": 5 * time.Millisecond,
+		"err":  errors.New("relation does not exist"),
+	})
+	pt.Log(ctx, 0, "closed connection", nil)
+	parent.End()
+
+	spans := sr.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 3", len(spans))
+	}
+
+	want := []struct {
+		name      string
+		system    string
+		id        string
+		statement string
+	}{
+		{"SET", "redis", "cache", "SET ? ?"},
+		{"Query", "postgresql", "main", "SELECT * FROM users WHERE email = ?"},
+	}
+	for i, w := range want {
+		span := spans[i]
+		if span.Name() != w.name || span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Fatalf("got span %s with parent %s, want %s under the request", span.Name(), span.Parent().SpanID(), w.name)
+		}
+		a := attrs(span)
+		if a["db.system"] != w.system || a["dbconnect.id"] != w.id || a["db.statement"] != w.statement {
+			t.Fatalf("%s: got attributes %v", w.name, a)
+		}
+	}
+	if spans[1].Status().Code != codes.Error || spans[1].EndTime().Sub(spans[1].StartTime()) != 5*time.Millisecond {
+		t.Fatalf("got status %v and duration %s, want a failed 5ms query", spans[1].Status(), spans[1].EndTime().Sub(spans[1].StartTime()))
+	}
+}
@@ -0,0 +1,245 @@
+package dbconnect
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Problem is a single invalid setting found in a config block
+type Problem struct {
+	Backend string // pq | redis | mongo | cockroachdb
+	ID      string
+	Err     error
+}
+
+func (p Problem) String() string {
+	if p.Backend == "" {
+		return fmt.Sprintf("\"%s\": %s", p.ID, p.Err.Error())
+	}
+	return fmt.Sprintf("%s \"%s\": %s", p.Backend, p.ID, p.Err.Error())
+}
+
+// Problems lists every block that failed; it is shared by ValidationError,
+// CloseError, WarmupError and DrainError
+type Problems []Problem
+
+// join renders ps on a single line after prefix
+func (ps Problems) join(prefix string) string {
+	lines := make([]string, 0, len(ps))
+	for _, p := range ps {
+		lines = append(lines, p.String())
+	}
+	return fmt.Sprintf("%s: %s", prefix, strings.Join(lines, "; "))
+}
+
+// orNil returns err only when ps holds problems
+func (ps Problems) orNil(err error) error {
+	if len(ps) > 0 {
+		return err
+	}
+	return nil
+}
+
+// ValidationError is returned by Config.Validate and lists every problem
+// found across all backend blocks
+type ValidationError struct {
+	Problems Problems
+}
+
+func (ve *ValidationError) Error() string {
+	return ve.Problems.join("invalid config")
+}
+
+func (ve *ValidationError) add(backend, id string, errs []error) {
+	for _, err := range errs {
+		ve.Problems = append(ve.Problems, Problem{Backend: backend, ID: id, Err: err})
+	}
+}
+
+// Validate checks every backend block of c and returns a *ValidationError
+// listing all problems found; nil when c is valid.
+// New and its variants call Validate after env expansion and defaults
+// have been applied, so a bad config fails at load time rather than
+// on the first getter call. Unset ports, sslmodes and networks stand for
+// their defaults, so a config can also be validated as decoded
+func (c *Config) Validate() error {
+	var ve ValidationError
+
+	ids := map[string]bool{}
+	for _, pc := range c.PQ {
+		ve.add("pq", pc.ID, checkID(ids, pc.ID))
+		ve.add("pq", pc.ID, pc.validate())
+	}
+
+	ids = map[string]bool{}
+	for _, rc := range c.CockroachDB {
+		ve.add("cockroachdb", rc.ID, checkID(ids, rc.ID))
+		ve.add("cockroachdb", rc.ID, rc.validate())
+	}
+
+	ids = map[string]bool{}
+	for _, rc := range c.Redis {
+		ve.add("redis", rc.ID, checkID(ids, rc.ID))
+		ve.add("redis", rc.ID, rc.validate())
+	}
+
+	ids = map[string]bool{}
+	for _, mc := range c.Mongo {
+		ve.add("mongo", mc.ID, checkID(ids, mc.ID))
+		ve.add("mongo", mc.ID, mc.validate())
+	}
+
+	return ve.Problems.orNil(&ve)
+}
+
+// expandEnv expands environment variables in every block; see expand for
+// the supported syntax. Fields that fail to expand are reported as problems
+func (c *Config) expandEnv() error {
+	var ve ValidationError
+
+	for _, pc := range c.PQ {
+		ve.add("pq", pc.ID, pc.expandEnv())
+	}
+	for _, rc := range c.CockroachDB {
+		ve.add("cockroachdb", rc.ID, rc.expandEnv())
+	}
+	for _, rc := range c.Redis {
+		ve.add("redis", rc.ID, rc.expandEnv())
+	}
+	for _, mc := range c.Mongo {
+		ve.add("mongo", mc.ID, mc.expandEnv())
+	}
+
+	return ve.Problems.orNil(&ve)
+}
+
+func (c *Config) defaults() {
+	for _, pc := range c.PQ {
+		pc.defaults()
+	}
+	for _, rc := range c.CockroachDB {
+		rc.defaults()
+	}
+	for _, rc := range c.Redis {
+		rc.defaults()
+	}
+	for _, mc := range c.Mongo {
+		mc.defaults()
+	}
+}
+
+func checkID(seen map[string]bool, id string) []error {
+	if id == "" {
+		return []error{fmt.Errorf("empty id")}
+	}
+	if seen[id] {
+		return []error{fmt.Errorf("duplicate id")}
+	}
+	seen[id] = true
+	return nil
+}
+
+// checkPort accepts 0, which stands for the default port of the backend
+func checkPort(port int) []error {
+	if port < 0 || port > 65535 {
+		return []error{fmt.Errorf("invalid port: %d", port)}
+	}
+	return nil
+}
+
+func checkSlowQuery(ms int) []error {
+	if ms < 0 {
+		return []error{fmt.Errorf("invalid slow_query_ms: %d", ms)}
+	}
+	return nil
+}
+
+func checkBreaker(failures, cooldownSeconds int) []error {
+	var errs []error
+	if failures < 0 {
+		errs = append(errs, fmt.Errorf("invalid breaker_failures: %d", failures))
+	}
+	if cooldownSeconds < 0 {
+		errs = append(errs, fmt.Errorf("invalid breaker_cooldown_seconds: %d", cooldownSeconds))
+	}
+	return errs
+}
+
+// checkFiles returns an error for every path that can't be stat'd.
+// Empty paths are skipped; secret references are rejected since the
+// driver reads these files itself
+func checkFiles(paths map[string]string) []error {
+	var errs []error
+	for _, k := range []string{"sslcert", "sslkey", "sslrootcert"} {
+		p := paths[k]
+		if p == "" {
+			continue
+		}
+		if isSecret(p) {
+			errs = append(errs, fmt.Errorf("%s: secret references aren't supported, a file path is expected", k))
+			continue
+		}
+		if _, err := os.Stat(p); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s", k, err.Error()))
+		}
+	}
+	return errs
+}
+
+func (pc *PQConfig) validate() []error {
+	var errs []error
+	if err := pc.assert(); err != nil {
+		errs = append(errs, err)
+	}
+	errs = append(errs, checkPort(pc.Port)...)
+	if pc.ConnectTimeout < 0 {
+		errs = append(errs, fmt.Errorf("invalid connect_timeout: %d", pc.ConnectTimeout))
+	}
+	errs = append(errs, checkBreaker(pc.BreakerFailures, pc.BreakerCooldownSeconds)...)
+	errs = append(errs, checkSlowQuery(pc.SlowQueryMs)...)
+	return append(errs, checkFiles(map[string]string{
+		"sslcert":     pc.SSLCert,
+		"sslkey":      pc.SSLKey,
+		"sslrootcert": pc.SSLRootCert,
+	})...)
+}
+
+func (rc *RoachConfig) validate() []error {
+	var errs []error
+	if err := rc.assert(); err != nil {
+		errs = append(errs, err)
+	}
+	errs = append(errs, checkPort(rc.Port)...)
+	errs = append(errs, checkBreaker(rc.BreakerFailures, rc.BreakerCooldownSeconds)...)
+	errs = append(errs, checkSlowQuery(rc.SlowQueryMs)...)
+	return append(errs, checkFiles(map[string]string{
+		"sslcert":     rc.SSLCert,
+		"sslkey":      rc.SSLKey,
+		"sslrootcert": rc.SSLRootCert,
+	})...)
+}
+
+func (rc *RedisConfig) validate() []error {
+	var errs []error
+	if err := rc.assert(); err != nil {
+		errs = append(errs, err)
+	}
+	if rc.Host != "" {
+		errs = append(errs, checkPort(rc.Port)...)
+	}
+	if rc.Network != "" && rc.Network != "tcp" && rc.Network != "unix" {
+		errs = append(errs, fmt.Errorf("invalid network: %s", rc.Network))
+	}
+	errs = append(errs, checkBreaker(rc.BreakerFailures, rc.BreakerCooldownSeconds)...)
+	return append(errs, checkSlowQuery(rc.SlowQueryMs)...)
+}
+
+func (mc *MongoConfig) validate() []error {
+	errs := checkBreaker(mc.BreakerFailures, mc.BreakerCooldownSeconds)
+	errs = append(errs, checkSlowQuery(mc.SlowQueryMs)...)
+	if mc.ConnectionString != "" {
+		return errs
+	}
+	return append(errs, checkPort(mc.Port)...)
+}
@@ -0,0 +1,113 @@
+package dbconnect
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// WarmupResult is the outcome of connecting and pinging a single block
+type WarmupResult struct {
+	Backend string
+	ID      string
+	// Latency covers connecting (when not connected yet) and the ping
+	Latency time.Duration
+	Err     error
+}
+
+// WarmupError lists every block that failed to connect or ping during Warmup
+type WarmupError struct {
+	Problems Problems
+}
+
+func (we *WarmupError) Error() string {
+	return we.Problems.join("warmup")
+}
+
+// Warmup connects and pings the blocks configured with ids, or every
+// block when no ids are given, in parallel. It returns a result per block
+// in config order, and a *WarmupError when any of them failed.
+// An id matches the blocks of every backend configured with it.
+// Blocks with eager = true are warmed up by New and its variants
+func (c *Conns) Warmup(ctx context.Context, ids ...string) ([]WarmupResult, error) {
+	c.mu.RLock()
+	if c.closed {
+		c.mu.RUnlock()
+		return nil, &Error{Kind: ErrClosed}
+	}
+	all := c.c.blocks()
+	c.mu.RUnlock()
+
+	var we WarmupError
+	var bs []block
+	if len(ids) == 0 {
+		for _, b := range all {
+			bs = append(bs, b)
+		}
+	}
+	for _, id := range ids {
+		found := false
+		for _, b := range all {
+			if b.ident() == id {
+				bs = append(bs, b)
+				found = true
+			}
+		}
+		if !found {
+			we.Problems = append(we.Problems, Problem{ID: id, Err: &Error{ID: id, Kind: ErrUnknownID}})
+		}
+	}
+
+	results := warmup(ctx, bs)
+	we.collect(results)
+	return results, we.Problems.orNil(&we)
+}
+
+func (we *WarmupError) collect(results []WarmupResult) {
+	for _, r := range results {
+		if r.Err != nil {
+			we.Problems = append(we.Problems, Problem{Backend: r.Backend, ID: r.ID, Err: r.Err})
+		}
+	}
+}
+
+// warmup opens and pings bs in parallel
+func warmup(ctx context.Context, bs []block) []WarmupResult {
+	results := make([]WarmupResult, len(bs))
+	var wg sync.WaitGroup
+	for i, b := range bs {
+		wg.Add(1)
+		go func(i int, b block) {
+			defer wg.Done()
+			start := time.Now()
+			err := b.open(ctx)
+			if err == nil {
+				if perr := ping(ctx, b); perr != nil {
+					err = blockError(b, ErrConnect, perr)
+				}
+			}
+			results[i] = WarmupResult{
+				Backend: b.backend(),
+				ID:      b.ident(),
+				Latency: time.Since(start),
+				Err:     err,
+			}
+		}(i, b)
+	}
+	wg.Wait()
+	return results
+}
+
+// warmupEager warms up every block configured with eager = true
+func (c *Conns) warmupEager() error {
+	var bs []block
+	for _, b := range c.c.blocks() {
+		if b.isEager() {
+			bs = append(bs, b)
+		}
+	}
+
+	var we WarmupError
+	we.collect(warmup(context.Background(), bs))
+	return we.Problems.orNil(&we)
+}
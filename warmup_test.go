@@ -0,0 +1,60 @@
+package dbconnect
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestWarmup(t *testing.T) {
+	conns, err := Build(
+		WithPostgres("main", downPQ(&PQConfig{})),
+		WithRedis("cache", downRedis(&RedisConfig{})),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conns.Close(context.Background())
+
+	results, err := conns.Warmup(context.Background())
+	var we *WarmupError
+	if !errors.As(err, &we) {
+		t.Fatalf("got %v, want *WarmupError", err)
+	}
+	if len(results) != 2 || len(we.Problems) != 2 {
+		t.Fatalf("got %d results and %d problems, want 2 and 2", len(results), len(we.Problems))
+	}
+	for _, r := range results {
+		if !errors.Is(r.Err, ErrConnect) {
+			t.Fatalf("%s %s: got %v, want ErrConnect", r.Backend, r.ID, r.Err)
+		}
+		if r.Latency <= 0 {
+			t.Fatalf("%s %s: latency was not measured", r.Backend, r.ID)
+		}
+	}
+
+	results, err = conns.Warmup(context.Background(), "cache", "reports")
+	if !errors.As(err, &we) {
+		t.Fatalf("got %v, want *WarmupError", err)
+	}
+	if len(results) != 1 || results[0].ID != "cache" {
+		t.Fatalf("got %v, want a single result for cache", results)
+	}
+	if !errors.Is(we.Problems[0].Err, ErrUnknownID) {
+		t.Fatalf("got %v, want ErrUnknownID", we.Problems[0].Err)
+	}
+}
+
+func TestEager(t *testing.T) {
+	_, err := Build(
+		WithRedis("cache", downRedis(&RedisConfig{Eager: true})),
+		WithRedis("lazy", downRedis(&RedisConfig{})),
+	)
+	var we *WarmupError
+	if !errors.As(err, &we) {
+		t.Fatalf("got %v, want *WarmupError", err)
+	}
+	if len(we.Problems) != 1 || we.Problems[0].ID != "cache" {
+		t.Fatalf("only eager blocks should be warmed up, got %v", we.Problems)
+	}
+}